@@ -6,9 +6,68 @@ import (
 	"time"
 )
 
+const (
+	NoExpiration time.Duration = -1 // 缓存未设置过期时间
+	KeyNotExist  time.Duration = -2 // 缓存不存在
+)
+
+// 缓存客户端，所有方法都接收 ctx，ctx 取消或超时后未完成的操作将返回错误
 type Client interface {
-	Set(key string, value []byte, expiration time.Duration) error
-	Get(key string) (value []byte, err error)
+	Set(ctx context.Context, key string, value []byte, expiration time.Duration) error
+
+	// 缓存不存在时原子地设置缓存并返回 true，缓存已存在则不做修改并返回 false
+	SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error)
+
+	Get(ctx context.Context, key string) (value []byte, err error)
+
+	// 删除缓存，不存在的缓存将被忽略
+	Delete(ctx context.Context, keys ...string) error
+
+	// 判断缓存是否存在
+	Exists(ctx context.Context, key string) (bool, error)
+
+	// 获得缓存剩余过期时间，缓存不存在返回 KeyNotExist，未设置过期时间返回 NoExpiration
+	TTL(ctx context.Context, key string) (time.Duration, error)
+
+	// 批量获得缓存，values 与 keys 一一对应，缓存不存在则对应值为 nil
+	MGet(ctx context.Context, keys ...string) (values [][]byte, err error)
+
+	// 批量设置缓存，所有缓存使用相同的过期时间
+	MSet(ctx context.Context, values map[string][]byte, expiration time.Duration) error
+
+	// 原子地将缓存值增加 value 并返回增加后的值，缓存不存在则从 0 开始增加，不改变过期时间
+	Incr(ctx context.Context, key string, value int64) (int64, error)
+
+	// 设置缓存过期时间，expiration 小于等于 0 则删除缓存，缓存不存在则返回 false
+	Expire(ctx context.Context, key string, expiration time.Duration) (bool, error)
+}
+
+// 可在一次调用中同时获得缓存及剩余过期时间的客户端，TieredClient 读取远程缓存时使用，避免额外查询 TTL
+type ttlReader interface {
+	// ttls 与 keys 一一对应，含义与 Client.TTL 相同
+	mgetWithTTL(ctx context.Context, keys ...string) (values [][]byte, ttls []time.Duration, err error)
+}
+
+// 批量获得缓存及剩余过期时间，client 未实现 ttlReader 时逐个查询已存在的缓存的 TTL
+func mgetWithTTL(ctx context.Context, client Client, keys ...string) (values [][]byte, ttls []time.Duration, err error) {
+	if r, ok := client.(ttlReader); ok {
+		return r.mgetWithTTL(ctx, keys...)
+	}
+	values, err = client.MGet(ctx, keys...)
+	if err != nil {
+		return nil, nil, err
+	}
+	ttls = make([]time.Duration, len(keys))
+	for i, value := range values {
+		ttls[i] = KeyNotExist
+		if value != nil {
+			ttls[i], err = client.TTL(ctx, keys[i])
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	return values, ttls, nil
 }
 
 type prefixKeyClient struct {
@@ -16,6 +75,7 @@ type prefixKeyClient struct {
 	client    Client
 }
 
+// 为所有 key 添加前缀，需要整体失效的前缀使用 WithNamespaceClient
 func WithPrefixClient(prefixKey string, client Client) Client {
 	return &prefixKeyClient{
 		prefixKey: prefixKey,
@@ -23,33 +83,204 @@ func WithPrefixClient(prefixKey string, client Client) Client {
 	}
 }
 
-func (p *prefixKeyClient) Set(key string, value []byte, expiration time.Duration) error {
-	return p.client.Set(p.prefixKey+key, value, expiration)
+func (p *prefixKeyClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	return p.client.Set(ctx, p.prefixKey+key, value, expiration)
+}
+
+func (p *prefixKeyClient) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	return p.client.SetNX(ctx, p.prefixKey+key, value, expiration)
+}
+
+func (p *prefixKeyClient) Get(ctx context.Context, key string) (value []byte, err error) {
+	return p.client.Get(ctx, p.prefixKey+key)
+}
+
+func (p *prefixKeyClient) Delete(ctx context.Context, keys ...string) error {
+	return p.client.Delete(ctx, p.prefixKeys(keys)...)
+}
+
+func (p *prefixKeyClient) Exists(ctx context.Context, key string) (bool, error) {
+	return p.client.Exists(ctx, p.prefixKey+key)
+}
+
+func (p *prefixKeyClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return p.client.TTL(ctx, p.prefixKey+key)
+}
+
+func (p *prefixKeyClient) MGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	return p.client.MGet(ctx, p.prefixKeys(keys)...)
+}
+
+func (p *prefixKeyClient) MSet(ctx context.Context, values map[string][]byte, expiration time.Duration) error {
+	prefixed := make(map[string][]byte, len(values))
+	for key, value := range values {
+		prefixed[p.prefixKey+key] = value
+	}
+	return p.client.MSet(ctx, prefixed, expiration)
+}
+
+func (p *prefixKeyClient) Incr(ctx context.Context, key string, value int64) (int64, error) {
+	return p.client.Incr(ctx, p.prefixKey+key, value)
 }
 
-func (p *prefixKeyClient) Get(key string) (value []byte, err error) {
-	return p.client.Get(key)
+func (p *prefixKeyClient) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return p.client.Expire(ctx, p.prefixKey+key, expiration)
+}
+
+func (p *prefixKeyClient) mgetWithTTL(ctx context.Context, keys ...string) (values [][]byte, ttls []time.Duration, err error) {
+	return mgetWithTTL(ctx, p.client, p.prefixKeys(keys)...)
+}
+
+func (p *prefixKeyClient) prefixKeys(keys []string) []string {
+	prefixed := make([]string, len(keys))
+	for i, key := range keys {
+		prefixed[i] = p.prefixKey + key
+	}
+	return prefixed
 }
 
 type redisClient struct {
-	client *redis.Client
+	client  redis.UniversalClient
+	timeout time.Duration
 }
 
-func NewRedisClient(client *redis.Client) Client {
-	return &redisClient{client: client}
+// client 可以为单节点、哨兵或集群客户端，集群模式下多 key 操作的 key 需要位于同一个 slot，参考 HashTag。
+// timeout 为单次调用的超时时间，0 表示不限制，此时仅受调用方 ctx 控制
+func NewRedisClient(client redis.UniversalClient, timeout time.Duration) Client {
+	return &redisClient{client: client, timeout: timeout}
 }
 
-var noCtx = context.Background()
+// 为单次调用设置超时时间
+func (r *redisClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout > 0 {
+		return context.WithTimeout(ctx, r.timeout)
+	}
+	return ctx, func() {}
+}
+
+func (r *redisClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.Set(ctx, key, string(value), expiration).Err()
+}
 
-func (r *redisClient) Set(key string, value []byte, expiration time.Duration) error {
-	return r.client.Set(noCtx, key, string(value), expiration).Err()
+func (r *redisClient) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.SetNX(ctx, key, string(value), expiration).Result()
 }
 
-func (r *redisClient) Get(key string) (value []byte, err error) {
-	value, err = r.client.Get(noCtx, key).Bytes()
+func (r *redisClient) Get(ctx context.Context, key string) (value []byte, err error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	value, err = r.client.Get(ctx, key).Bytes()
 	if err != nil && err != redis.Nil {
 		return nil, err
 	} else {
 		return value, nil
 	}
 }
+
+func (r *redisClient) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.Del(ctx, keys...).Err()
+}
+
+func (r *redisClient) Exists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	n, err := r.client.Exists(ctx, key).Result()
+	return n > 0, err
+}
+
+func (r *redisClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	// go-redis 对于不存在或未设置过期时间的缓存返回 -2ns 及 -1ns，与 KeyNotExist 及 NoExpiration 一致
+	return r.client.PTTL(ctx, key).Result()
+}
+
+func (r *redisClient) MGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	results, err := r.client.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	values = make([][]byte, len(results))
+	for i, result := range results {
+		if s, ok := result.(string); ok {
+			values[i] = []byte(s)
+		}
+	}
+	return values, nil
+}
+
+// 通过管道同时查询 MGET 及各 key 的 PTTL
+func (r *redisClient) mgetWithTTL(ctx context.Context, keys ...string) (values [][]byte, ttls []time.Duration, err error) {
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	var mget *redis.SliceCmd
+	pttls := make([]*redis.DurationCmd, len(keys))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		mget = pipe.MGet(ctx, keys...)
+		for i, key := range keys {
+			pttls[i] = pipe.PTTL(ctx, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	values = make([][]byte, len(keys))
+	ttls = make([]time.Duration, len(keys))
+	for i, result := range mget.Val() {
+		if s, ok := result.(string); ok {
+			values[i] = []byte(s)
+		}
+		ttls[i] = pttls[i].Val()
+	}
+	return values, ttls, nil
+}
+
+func (r *redisClient) MSet(ctx context.Context, values map[string][]byte, expiration time.Duration) error {
+	if len(values) == 0 {
+		return nil
+	}
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	// MSET 不支持过期时间，因此通过事务批量 SET
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for key, value := range values {
+			pipe.Set(ctx, key, string(value), expiration)
+		}
+		return nil
+	})
+	return err
+}
+
+func (r *redisClient) Incr(ctx context.Context, key string, value int64) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	return r.client.IncrBy(ctx, key, value).Result()
+}
+
+func (r *redisClient) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+	if expiration <= 0 {
+		n, err := r.client.Del(ctx, key).Result()
+		return n > 0, err
+	}
+	return r.client.PExpire(ctx, key, expiration).Result()
+}
@@ -0,0 +1,136 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"testing"
+	"time"
+)
+
+// 缓存客户端行为测试，所有 cache.Client 实现都需要通过该测试，
+// fastForward 用于将客户端的当前时间向前推进
+func testClient(t *testing.T, client cache.Client, fastForward func(d time.Duration)) {
+	ctx := context.Background()
+	type testcase struct {
+		key        string
+		value      []byte
+		expiration time.Duration
+	}
+	var testcases = []testcase{
+		{key: "key_01", value: []byte("value_01"), expiration: 0},
+		{key: "key_02", value: []byte("value_02"), expiration: time.Minute},
+		{key: "key_03", value: []byte("value_03"), expiration: 2 * time.Minute},
+	}
+	for _, tc := range testcases {
+		err := client.Set(ctx, tc.key, tc.value, tc.expiration)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 未设置的缓存返回空值
+	value, err := client.Get(ctx, "not_exist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value != nil {
+		t.Errorf("not_exist need: nil, got: %s\n", value)
+	}
+	// 覆盖已有缓存
+	err = client.Set(ctx, "key_01", []byte("value_01_new"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testcases[0].value = []byte("value_01_new")
+
+	fastForward(90 * time.Second)
+	for _, tc := range testcases {
+		var need []byte
+		if tc.expiration == 0 || tc.expiration > 90*time.Second {
+			need = tc.value
+		}
+		got, err := client.Get(ctx, tc.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, need) {
+			t.Errorf("%s need: %s, got: %s\n", tc.key, need, got)
+		}
+	}
+
+	// 批量操作
+	err = client.MSet(ctx, map[string][]byte{"m_01": []byte("1"), "m_02": []byte("2")}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err := client.MGet(ctx, "m_01", "not_exist", "m_02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, need := range [][]byte{[]byte("1"), nil, []byte("2")} {
+		if !bytes.Equal(values[i], need) {
+			t.Errorf("mget %d need: %s, got: %s\n", i, need, values[i])
+		}
+	}
+	// 过期时间
+	for key, need := range map[string]time.Duration{"key_01": cache.NoExpiration, "not_exist": cache.KeyNotExist, "m_01": time.Minute} {
+		ttl, err := client.TTL(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ttl != need {
+			t.Errorf("ttl %s need: %v, got: %v\n", key, need, ttl)
+		}
+	}
+	ok, err := client.Expire(ctx, "key_01", time.Minute)
+	if err != nil || !ok {
+		t.Errorf("expire key_01 need: true, got: %t, %v\n", ok, err)
+	}
+	ok, err = client.Expire(ctx, "not_exist", time.Minute)
+	if err != nil || ok {
+		t.Errorf("expire not_exist need: false, got: %t, %v\n", ok, err)
+	}
+	// 计数器
+	for _, tc := range [][2]int64{{1, 1}, {2, 3}, {-3, 0}} {
+		n, err := client.Incr(ctx, "counter", tc[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tc[1] {
+			t.Errorf("incr %d need: %d, got: %d\n", tc[0], tc[1], n)
+		}
+	}
+	// 不存在时设置
+	for _, need := range []bool{true, false} {
+		ok, err = client.SetNX(ctx, "nx", []byte("value"), 30*time.Second)
+		if err != nil || ok != need {
+			t.Errorf("setnx nx need: %t, got: %t, %v\n", need, ok, err)
+		}
+	}
+	// 删除
+	err = client.Delete(ctx, "key_01", "m_01", "not_exist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, need := range map[string]bool{"key_01": false, "m_01": false, "m_02": true} {
+		exist, err := client.Exists(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if exist != need {
+			t.Errorf("exists %s need: %t, got: %t\n", key, need, exist)
+		}
+	}
+	fastForward(time.Minute)
+	exist, err := client.Exists(ctx, "m_02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exist {
+		t.Errorf("exists m_02 need: false, got: true\n")
+	}
+	ok, err = client.SetNX(ctx, "nx", []byte("value"), 30*time.Second)
+	if err != nil || !ok {
+		t.Errorf("setnx expired nx need: true, got: %t, %v\n", ok, err)
+	}
+}
@@ -0,0 +1,87 @@
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+var ErrUnsupportedType = errors.New("cache: unsupported type for raw codec")
+
+// 编解码器，用于将数据序列化后存入缓存
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+	JSON    Codec = jsonCodec{}    // JSON 编码
+	Gob     Codec = gobCodec{}     // gob 编码，适用于仅由 Go 程序读写的缓存
+	Msgpack Codec = msgpackCodec{} // msgpack 编码，比 JSON 更紧凑
+	Raw     Codec = rawCodec{}     // 不编码，仅支持 []byte 及 string
+)
+
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+type gobCodec struct{}
+
+func (gobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := gob.NewEncoder(buf).Encode(v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+type rawCodec struct{}
+
+// v 的类型必须为 []byte 或 string
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case []byte:
+		return value, nil
+	case string:
+		return []byte(value), nil
+	default:
+		return nil, ErrUnsupportedType
+	}
+}
+
+// v 的类型必须为 *[]byte 或 *string
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	switch value := v.(type) {
+	case *[]byte:
+		*value = copyBytes(data)
+		return nil
+	case *string:
+		*value = string(data)
+		return nil
+	default:
+		return ErrUnsupportedType
+	}
+}
@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/rand"
+)
+
+// 缓存失效通知器，用于在多个实例之间广播失效的 key
+type Invalidator interface {
+	// 广播失效的 key
+	Publish(ctx context.Context, keys []string) error
+
+	// 订阅其他实例广播的失效通知，handler 在后台协程中执行，不会收到本实例广播的通知
+	Subscribe(ctx context.Context, handler func(keys []string)) error
+
+	// 停止订阅
+	Close() error
+}
+
+type redisInvalidator struct {
+	id      string // 实例 ID，用于忽略本实例广播的通知
+	channel string
+	client  redis.UniversalClient
+	pubsub  *redis.PubSub
+}
+
+// 基于 Redis 发布订阅的失效通知器，所有实例需要使用相同的 channel
+func NewRedisInvalidator(client redis.UniversalClient, channel string) Invalidator {
+	return &redisInvalidator{
+		id:      rand.Str(16),
+		channel: channel,
+		client:  client,
+	}
+}
+
+type invalidation struct {
+	From string
+	Keys []string
+}
+
+func (r *redisInvalidator) Publish(ctx context.Context, keys []string) error {
+	data, err := json.Marshal(invalidation{From: r.id, Keys: keys})
+	if err != nil {
+		return err
+	}
+	return r.client.Publish(ctx, r.channel, data).Err()
+}
+
+func (r *redisInvalidator) Subscribe(ctx context.Context, handler func(keys []string)) error {
+	r.pubsub = r.client.Subscribe(ctx, r.channel)
+	// 等待订阅成功
+	_, err := r.pubsub.Receive(ctx)
+	if err != nil {
+		_ = r.pubsub.Close()
+		return err
+	}
+	go func(messages <-chan *redis.Message) {
+		for message := range messages {
+			inv := invalidation{}
+			if json.Unmarshal([]byte(message.Payload), &inv) == nil && inv.From != r.id {
+				handler(inv.Keys)
+			}
+		}
+	}(r.pubsub.Channel())
+	return nil
+}
+
+func (r *redisInvalidator) Close() error {
+	if r.pubsub == nil {
+		return nil
+	}
+	return r.pubsub.Close()
+}
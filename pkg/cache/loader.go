@@ -0,0 +1,133 @@
+package cache
+
+import (
+	"context"
+	"golang.org/x/sync/singleflight"
+	"time"
+)
+
+// 数据加载函数，found 为 false 表示数据源中不存在该数据
+type LoadFunc func(ctx context.Context) (v interface{}, found bool, err error)
+
+// 默认加载超时时间
+const DefaultLoadTimeout = 10 * time.Second
+
+type LoadOptions struct {
+	NotFoundExpiration time.Duration // 不存在的数据的缓存时间(负缓存)，0 表示不缓存不存在的数据
+	RefreshAhead       time.Duration // 缓存剩余时间小于该值时在后台提前刷新，0 表示不提前刷新，开启后每次命中都会额外查询一次过期时间
+	LoadTimeout        time.Duration // 加载及写入缓存的超时时间，加载不受调用方取消的影响，0 表示使用 DefaultLoadTimeout
+}
+
+// 读穿透缓存，缓存不存在时通过 LoadFunc 加载数据并写入缓存，同一 key 的并发加载只会执行一次
+type Loader struct {
+	typed   *Typed
+	options LoadOptions
+	group   singleflight.Group
+}
+
+// 缓存过期时间及编解码器由 typed 决定
+func NewLoader(typed *Typed, options LoadOptions) *Loader {
+	if options.LoadTimeout <= 0 {
+		options.LoadTimeout = DefaultLoadTimeout
+	}
+	return &Loader{
+		typed:   typed,
+		options: options,
+	}
+}
+
+// 获得缓存并解码至 v，缓存不存在则通过 load 加载，found 为 false 表示数据源中不存在该数据。
+// 并发加载同一 key 时只有第一个调用者的 load 会被执行，其余调用者共享该结果。
+// load 使用脱离调用方取消的 ctx(保留 ctx 中的值)并受 LoadTimeout 限制，调用方取消时仅该调用方返回 ctx.Err()，加载继续进行
+func (l *Loader) GetOrLoad(ctx context.Context, key string, v interface{}, load LoadFunc) (found bool, err error) {
+	data, err := l.typed.client.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	// 没有数据标记的数据(如旧版本写入的数据)同样重新加载
+	if !valueEntry(data) && !notFoundEntry(data) {
+		data = nil
+	}
+	if data == nil {
+		ch := l.group.DoChan(key, func() (interface{}, error) {
+			return l.detachedLoad(ctx, key, load)
+		})
+		select {
+		case result := <-ch:
+			if result.Err != nil {
+				return false, result.Err
+			}
+			data = result.Val.([]byte)
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	} else if l.options.RefreshAhead > 0 {
+		l.refreshAhead(ctx, key, load)
+	}
+	return l.typed.decode(data, v)
+}
+
+// 加载数据并写入缓存，返回编码后的数据，数据不存在则返回 notFoundMarker
+func (l *Loader) load(ctx context.Context, key string, load LoadFunc) ([]byte, error) {
+	v, found, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		if l.options.NotFoundExpiration > 0 {
+			err = l.typed.SetNotFound(ctx, key, l.options.NotFoundExpiration)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return notFoundMarker, nil
+	}
+	data, err := l.typed.encode(v)
+	if err != nil {
+		return nil, err
+	}
+	err = l.typed.client.Set(ctx, key, data, l.typed.expiration)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// 使用脱离调用方取消的 ctx 加载数据，超时时间为 LoadTimeout
+func (l *Loader) detachedLoad(ctx context.Context, key string, load LoadFunc) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(detachedContext{parent: ctx}, l.options.LoadTimeout)
+	defer cancel()
+	return l.load(ctx, key, load)
+}
+
+// 缓存即将过期时在后台刷新缓存，刷新不受调用方取消的影响
+func (l *Loader) refreshAhead(ctx context.Context, key string, load LoadFunc) {
+	ttl, err := l.typed.client.TTL(ctx, key)
+	if err != nil || ttl < 0 || ttl >= l.options.RefreshAhead {
+		return
+	}
+	go l.group.Do(key, func() (interface{}, error) {
+		return l.detachedLoad(ctx, key, load)
+	})
+}
+
+// 保留 parent 中的值但不继承其取消及截止时间
+type detachedContext struct {
+	parent context.Context
+}
+
+func (detachedContext) Deadline() (deadline time.Time, ok bool) {
+	return time.Time{}, false
+}
+
+func (detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (detachedContext) Err() error {
+	return nil
+}
+
+func (d detachedContext) Value(key interface{}) interface{} {
+	return d.parent.Value(key)
+}
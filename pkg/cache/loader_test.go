@@ -0,0 +1,164 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/x_time"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLoader_Singleflight(t *testing.T) {
+	ctx := context.Background()
+	client := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer client.Stop()
+	loader := cache.NewLoader(cache.NewTyped(client, cache.JSON, time.Minute), cache.LoadOptions{})
+	var loads int32
+	load := func(ctx context.Context) (interface{}, bool, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(20 * time.Millisecond)
+		return "value", true, nil
+	}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var v string
+			found, err := loader.GetOrLoad(ctx, "key", &v, load)
+			if err != nil || !found || v != "value" {
+				t.Errorf("need: value, true, got: %s, %t, %v\n", v, found, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if loads != 1 {
+		t.Errorf("loads need: 1, got: %d\n", loads)
+	}
+}
+
+func TestLoader_NotFound(t *testing.T) {
+	ctx := context.Background()
+	client := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer client.Stop()
+	typed := cache.NewTyped(client, cache.JSON, time.Minute)
+	loader := cache.NewLoader(typed, cache.LoadOptions{NotFoundExpiration: time.Minute})
+	loads := 0
+	load := func(ctx context.Context) (interface{}, bool, error) {
+		loads++
+		return nil, false, nil
+	}
+	for i := 0; i < 3; i++ {
+		var v int
+		found, err := loader.GetOrLoad(ctx, "key", &v, load)
+		if err != nil || found {
+			t.Errorf("need: not found, got: %t, %v\n", found, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads need: 1, got: %d\n", loads)
+	}
+	var v int
+	found, err := typed.Get(ctx, "key", &v)
+	if err != nil || found {
+		t.Errorf("typed need: not found, got: %t, %v\n", found, err)
+	}
+}
+
+func TestLoader_RawNotFound(t *testing.T) {
+	ctx := context.Background()
+	client := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer client.Stop()
+	typed := cache.NewTyped(client, cache.Raw, time.Minute)
+	loader := cache.NewLoader(typed, cache.LoadOptions{NotFoundExpiration: time.Minute})
+	// 旧版本写入的没有数据标记的数据重新加载
+	_ = client.Set(ctx, "unmarked", []byte("old"), 0)
+	var v string
+	found, err := loader.GetOrLoad(ctx, "unmarked", &v, func(ctx context.Context) (interface{}, bool, error) {
+		return "\x00", true, nil
+	})
+	if err != nil || !found || v != "\x00" {
+		t.Errorf("need: \\x00, true, got: %q, %t, %v\n", v, found, err)
+	}
+	// 与负缓存标记相同的数据不会被视为不存在
+	v = ""
+	found, err = loader.GetOrLoad(ctx, "unmarked", &v, func(ctx context.Context) (interface{}, bool, error) {
+		return nil, false, nil
+	})
+	if err != nil || !found || v != "\x00" {
+		t.Errorf("cached need: \\x00, true, got: %q, %t, %v\n", v, found, err)
+	}
+}
+
+func TestLoader_RefreshAhead(t *testing.T) {
+	ctx := context.Background()
+	clock := x_time.NewFake(time.Now())
+	client := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+	defer client.Stop()
+	loader := cache.NewLoader(cache.NewTyped(client, cache.JSON, time.Minute), cache.LoadOptions{RefreshAhead: 30 * time.Second})
+	var loads int32
+	load := func(ctx context.Context) (interface{}, bool, error) {
+		return atomic.AddInt32(&loads, 1), true, nil
+	}
+	var v int32
+	_, _ = loader.GetOrLoad(ctx, "key", &v, load)
+	clock.Advance(40 * time.Second)
+	_, _ = loader.GetOrLoad(ctx, "key", &v, load)
+	if v != 1 {
+		t.Errorf("need: 1, got: %d\n", v)
+	}
+	// 等待后台刷新完成
+	ttl, _ := client.TTL(ctx, "key")
+	for i := 0; i < 100 && ttl != time.Minute; i++ {
+		time.Sleep(time.Millisecond)
+		ttl, _ = client.TTL(ctx, "key")
+	}
+	if ttl != time.Minute {
+		t.Errorf("ttl need: %v, got: %v\n", time.Minute, ttl)
+	}
+}
+
+func TestLoader_CanceledCaller(t *testing.T) {
+	client := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer client.Stop()
+	loader := cache.NewLoader(cache.NewTyped(client, cache.JSON, time.Minute), cache.LoadOptions{})
+	started := make(chan struct{})
+	release := make(chan struct{})
+	once := sync.Once{}
+	load := func(ctx context.Context) (interface{}, bool, error) {
+		once.Do(func() { close(started) })
+		<-release
+		// 第一个调用者取消后加载仍可继续
+		if ctx.Err() != nil {
+			return nil, false, ctx.Err()
+		}
+		return "value", true, nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		var v string
+		_, err := loader.GetOrLoad(ctx, "key", &v, load)
+		first <- err
+	}()
+	<-started
+	second := make(chan error, 1)
+	var v string
+	go func() {
+		found, err := loader.GetOrLoad(context.Background(), "key", &v, load)
+		if err == nil && !found {
+			t.Error("need found, got: false")
+		}
+		second <- err
+	}()
+	cancel()
+	if err := <-first; err != context.Canceled {
+		t.Errorf("first caller need: %v, got: %v\n", context.Canceled, err)
+	}
+	close(release)
+	if err := <-second; err != nil || v != "value" {
+		t.Errorf("second caller need: value, got: %s, %v\n", v, err)
+	}
+}
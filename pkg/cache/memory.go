@@ -0,0 +1,291 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"github.com/morgine/moon/pkg/x_time"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrNotInteger = errors.New("cache: value is not an integer")
+
+// 内存缓存配置
+type MemoryConfig struct {
+	MaxEntries    int           // 最大缓存条数，超出后淘汰最久未使用的数据，0 表示不限制
+	SweepInterval time.Duration // 后台清理过期数据的间隔，0 表示不启动后台清理，过期数据仅在访问时删除
+	Clock         x_time.Clock  // 时钟，为空则使用系统时间
+}
+
+// 进程内缓存客户端，支持过期时间及 LRU 淘汰，适用于测试及单节点部署，内存操作不会阻塞，因此忽略 ctx
+type MemoryClient struct {
+	config  MemoryConfig
+	clock   x_time.Clock
+	entries map[string]*list.Element
+	lru     *list.List // 链表头部为最近使用的数据
+	mu      sync.Mutex
+	stop    chan struct{}
+	once    sync.Once
+}
+
+type memoryEntry struct {
+	key      string
+	value    []byte
+	expireAt time.Time // 零值表示永不过期
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+func NewMemoryClient(config MemoryConfig) *MemoryClient {
+	m := &MemoryClient{
+		config:  config,
+		clock:   x_time.Or(config.Clock),
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		stop:    make(chan struct{}),
+	}
+	if config.SweepInterval > 0 {
+		go m.sweep(config.SweepInterval)
+	}
+	return m
+}
+
+func (m *MemoryClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.set(key, value, expiration)
+	return nil
+}
+
+func (m *MemoryClient) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.get(key) != nil {
+		return false, nil
+	}
+	m.set(key, value, expiration)
+	return true, nil
+}
+
+// 获得缓存，缓存不存在或已过期则返回 nil
+func (m *MemoryClient) Get(ctx context.Context, key string) (value []byte, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el := m.get(key)
+	if el == nil {
+		return nil, nil
+	}
+	m.lru.MoveToFront(el)
+	return copyBytes(el.Value.(*memoryEntry).value), nil
+}
+
+func (m *MemoryClient) Delete(ctx context.Context, keys ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		if el, ok := m.entries[key]; ok {
+			m.remove(el)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryClient) Exists(ctx context.Context, key string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.get(key) != nil, nil
+}
+
+func (m *MemoryClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el := m.get(key)
+	if el == nil {
+		return KeyNotExist, nil
+	}
+	entry := el.Value.(*memoryEntry)
+	if entry.expireAt.IsZero() {
+		return NoExpiration, nil
+	}
+	return entry.expireAt.Sub(m.clock.Now()), nil
+}
+
+func (m *MemoryClient) MGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values = make([][]byte, len(keys))
+	for i, key := range keys {
+		if el := m.get(key); el != nil {
+			m.lru.MoveToFront(el)
+			values[i] = copyBytes(el.Value.(*memoryEntry).value)
+		}
+	}
+	return values, nil
+}
+
+func (m *MemoryClient) mgetWithTTL(ctx context.Context, keys ...string) (values [][]byte, ttls []time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	values = make([][]byte, len(keys))
+	ttls = make([]time.Duration, len(keys))
+	for i, key := range keys {
+		ttls[i] = KeyNotExist
+		if el := m.get(key); el != nil {
+			m.lru.MoveToFront(el)
+			entry := el.Value.(*memoryEntry)
+			values[i] = copyBytes(entry.value)
+			ttls[i] = NoExpiration
+			if !entry.expireAt.IsZero() {
+				ttls[i] = entry.expireAt.Sub(now)
+			}
+		}
+	}
+	return values, ttls, nil
+}
+
+func (m *MemoryClient) MSet(ctx context.Context, values map[string][]byte, expiration time.Duration) error {
+	for key, value := range values {
+		_ = m.Set(ctx, key, value, expiration)
+	}
+	return nil
+}
+
+func (m *MemoryClient) Incr(ctx context.Context, key string, value int64) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el := m.get(key)
+	if el == nil {
+		el = m.lru.PushFront(&memoryEntry{key: key})
+		m.entries[key] = el
+		m.evict()
+	} else {
+		m.lru.MoveToFront(el)
+	}
+	entry := el.Value.(*memoryEntry)
+	var n int64
+	if len(entry.value) > 0 {
+		var err error
+		n, err = strconv.ParseInt(string(entry.value), 10, 64)
+		if err != nil {
+			return 0, ErrNotInteger
+		}
+	}
+	n += value
+	entry.value = []byte(strconv.FormatInt(n, 10))
+	return n, nil
+}
+
+func (m *MemoryClient) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	el := m.get(key)
+	if el == nil {
+		return false, nil
+	}
+	if expiration <= 0 {
+		m.remove(el)
+	} else {
+		el.Value.(*memoryEntry).expireAt = m.clock.Now().Add(expiration)
+	}
+	return true, nil
+}
+
+// 获得当前缓存条数(包含已过期但未被清理的数据)
+func (m *MemoryClient) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.lru.Len()
+}
+
+// 停止后台清理，可重复调用
+func (m *MemoryClient) Stop() {
+	m.once.Do(func() {
+		close(m.stop)
+	})
+}
+
+// 设置缓存，需要上锁
+func (m *MemoryClient) set(key string, value []byte, expiration time.Duration) {
+	// 与 Redis 一致，空值也视为存在的缓存
+	entry := &memoryEntry{key: key, value: append([]byte{}, value...)}
+	if expiration > 0 {
+		entry.expireAt = m.clock.Now().Add(expiration)
+	}
+	if el, ok := m.entries[key]; ok {
+		el.Value = entry
+		m.lru.MoveToFront(el)
+	} else {
+		m.entries[key] = m.lru.PushFront(entry)
+		m.evict()
+	}
+}
+
+// 获得未过期的数据，过期数据将被删除，需要上锁
+func (m *MemoryClient) get(key string) *list.Element {
+	el, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+	if el.Value.(*memoryEntry).expired(m.clock.Now()) {
+		m.remove(el)
+		return nil
+	}
+	return el
+}
+
+// 删除数据，需要上锁
+func (m *MemoryClient) remove(el *list.Element) {
+	m.lru.Remove(el)
+	delete(m.entries, el.Value.(*memoryEntry).key)
+}
+
+// 超出最大条数时淘汰最久未使用的数据，需要上锁
+func (m *MemoryClient) evict() {
+	if m.config.MaxEntries <= 0 {
+		return
+	}
+	for m.lru.Len() > m.config.MaxEntries {
+		m.remove(m.lru.Back())
+	}
+}
+
+// 清理所有过期数据
+func (m *MemoryClient) removeExpired() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.clock.Now()
+	for el := m.lru.Front(); el != nil; {
+		next := el.Next()
+		if el.Value.(*memoryEntry).expired(now) {
+			m.remove(el)
+		}
+		el = next
+	}
+}
+
+func (m *MemoryClient) sweep(interval time.Duration) {
+	ticker := m.clock.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			m.removeExpired()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func copyBytes(data []byte) []byte {
+	if data == nil {
+		return nil
+	}
+	c := make([]byte, len(data))
+	copy(c, data)
+	return c
+}
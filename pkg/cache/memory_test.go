@@ -0,0 +1,62 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/x_time"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryClient(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	client := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+	defer client.Stop()
+	testClient(t, client, clock.Advance)
+}
+
+func TestMemoryClient_LRU(t *testing.T) {
+	ctx := context.Background()
+	client := cache.NewMemoryClient(cache.MemoryConfig{MaxEntries: 3})
+	defer client.Stop()
+	for i := 1; i <= 3; i++ {
+		_ = client.Set(ctx, strconv.Itoa(i), []byte(strconv.Itoa(i)), 0)
+	}
+	// 访问 1 后，2 成为最久未使用的数据
+	_, _ = client.Get(ctx, "1")
+	_ = client.Set(ctx, "4", []byte("4"), 0)
+	if got := client.Len(); got != 3 {
+		t.Errorf("len need: 3, got: %d\n", got)
+	}
+	for key, exist := range map[string]bool{"1": true, "2": false, "3": true, "4": true} {
+		value, _ := client.Get(ctx, key)
+		if (value != nil) != exist {
+			t.Errorf("%s exist need: %t, got: %t\n", key, exist, value != nil)
+		}
+	}
+}
+
+func TestMemoryClient_Sweep(t *testing.T) {
+	ctx := context.Background()
+	client := cache.NewMemoryClient(cache.MemoryConfig{SweepInterval: 10 * time.Millisecond})
+	_ = client.Set(ctx, "expired", []byte("1"), time.Millisecond)
+	_ = client.Set(ctx, "persistent", []byte("1"), 0)
+	time.Sleep(50 * time.Millisecond)
+	if got := client.Len(); got != 1 {
+		t.Errorf("len need: 1, got: %d\n", got)
+	}
+	client.Stop()
+	client.Stop()
+}
+
+func TestPrefixClient(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	memory := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+	defer memory.Stop()
+	testClient(t, cache.WithPrefixClient("prefix_", memory), clock.Advance)
+	counter, _ := memory.Get(context.Background(), "prefix_counter")
+	if string(counter) != "0" {
+		t.Errorf("prefix_counter need: 0, got: %s\n", counter)
+	}
+}
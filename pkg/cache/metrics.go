@@ -0,0 +1,184 @@
+package cache
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// 一次缓存操作的统计数据
+type Observation struct {
+	Prefix  string        // key 前缀，未匹配任何已知前缀则为空
+	Op      string        // 操作名称，如 get、set、mget
+	Latency time.Duration // 操作耗时
+	Hits    int           // 读取操作命中的 key 数量，不包括负缓存
+	Misses  int           // 读取操作未命中的 key 数量
+	Bytes   int           // 读取或写入数据的字节数
+	Err     error         // 操作错误
+	// 读取操作命中负缓存(Typed.SetNotFound 及 Loader 写入的数据源中不存在的标记)的 key 数量
+	NegativeHits int
+}
+
+// 指标收集器，可对接 Prometheus、StatsD 等监控系统
+type MetricsSink interface {
+	Observe(o Observation)
+}
+
+type metricsClient struct {
+	client   Client
+	sink     MetricsSink
+	prefixes []string
+}
+
+// 为缓存客户端增加指标统计，统计数据按 prefixes 中第一个匹配的前缀分组，
+// 前缀需要事先声明，避免将用户 ID 等动态数据作为分组导致指标数量无限增长
+func NewMetricsClient(client Client, sink MetricsSink, prefixes ...string) Client {
+	return &metricsClient{
+		client:   client,
+		sink:     sink,
+		prefixes: prefixes,
+	}
+}
+
+func (m *metricsClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	start := time.Now()
+	err := m.client.Set(ctx, key, value, expiration)
+	m.observe(key, Observation{Op: "set", Latency: time.Since(start), Bytes: len(value), Err: err})
+	return err
+}
+
+func (m *metricsClient) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := m.client.SetNX(ctx, key, value, expiration)
+	m.observe(key, Observation{Op: "setnx", Latency: time.Since(start), Bytes: len(value), Err: err})
+	return ok, err
+}
+
+func (m *metricsClient) Get(ctx context.Context, key string) (value []byte, err error) {
+	start := time.Now()
+	value, err = m.client.Get(ctx, key)
+	o := Observation{Op: "get", Latency: time.Since(start), Bytes: len(value), Err: err}
+	if err == nil {
+		if notFoundEntry(value) {
+			o.NegativeHits = 1
+		} else if value != nil {
+			o.Hits = 1
+		} else {
+			o.Misses = 1
+		}
+	}
+	m.observe(key, o)
+	return value, err
+}
+
+func (m *metricsClient) Delete(ctx context.Context, keys ...string) error {
+	start := time.Now()
+	err := m.client.Delete(ctx, keys...)
+	latency := time.Since(start)
+	for prefix := range m.group(keys) {
+		m.sink.Observe(Observation{Prefix: prefix, Op: "delete", Latency: latency, Err: err})
+	}
+	return err
+}
+
+func (m *metricsClient) Exists(ctx context.Context, key string) (bool, error) {
+	start := time.Now()
+	ok, err := m.client.Exists(ctx, key)
+	m.observe(key, Observation{Op: "exists", Latency: time.Since(start), Err: err})
+	return ok, err
+}
+
+func (m *metricsClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := m.client.TTL(ctx, key)
+	m.observe(key, Observation{Op: "ttl", Latency: time.Since(start), Err: err})
+	return ttl, err
+}
+
+func (m *metricsClient) MGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	start := time.Now()
+	values, err = m.client.MGet(ctx, keys...)
+	m.observeMGet(keys, values, time.Since(start), err)
+	return values, err
+}
+
+// 与 MGet 统计为相同的操作
+func (m *metricsClient) mgetWithTTL(ctx context.Context, keys ...string) (values [][]byte, ttls []time.Duration, err error) {
+	start := time.Now()
+	values, ttls, err = mgetWithTTL(ctx, m.client, keys...)
+	m.observeMGet(keys, values, time.Since(start), err)
+	return values, ttls, err
+}
+
+func (m *metricsClient) observeMGet(keys []string, values [][]byte, latency time.Duration, err error) {
+	for prefix, idx := range m.group(keys) {
+		o := Observation{Prefix: prefix, Op: "mget", Latency: latency, Err: err}
+		if err == nil {
+			for _, i := range idx {
+				if notFoundEntry(values[i]) {
+					o.NegativeHits++
+					o.Bytes += len(values[i])
+				} else if values[i] != nil {
+					o.Hits++
+					o.Bytes += len(values[i])
+				} else {
+					o.Misses++
+				}
+			}
+		}
+		m.sink.Observe(o)
+	}
+}
+
+func (m *metricsClient) MSet(ctx context.Context, values map[string][]byte, expiration time.Duration) error {
+	start := time.Now()
+	err := m.client.MSet(ctx, values, expiration)
+	latency := time.Since(start)
+	sizes := map[string]int{}
+	for key, value := range values {
+		sizes[m.prefix(key)] += len(value)
+	}
+	for prefix, size := range sizes {
+		m.sink.Observe(Observation{Prefix: prefix, Op: "mset", Latency: latency, Bytes: size, Err: err})
+	}
+	return err
+}
+
+func (m *metricsClient) Incr(ctx context.Context, key string, value int64) (int64, error) {
+	start := time.Now()
+	n, err := m.client.Incr(ctx, key, value)
+	m.observe(key, Observation{Op: "incr", Latency: time.Since(start), Err: err})
+	return n, err
+}
+
+func (m *metricsClient) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := m.client.Expire(ctx, key, expiration)
+	m.observe(key, Observation{Op: "expire", Latency: time.Since(start), Err: err})
+	return ok, err
+}
+
+func (m *metricsClient) observe(key string, o Observation) {
+	o.Prefix = m.prefix(key)
+	m.sink.Observe(o)
+}
+
+// 获得 key 对应的已知前缀
+func (m *metricsClient) prefix(key string) string {
+	for _, prefix := range m.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return prefix
+		}
+	}
+	return ""
+}
+
+// 按前缀将 keys 分组，返回前缀及对应 key 的下标
+func (m *metricsClient) group(keys []string) map[string][]int {
+	groups := map[string][]int{}
+	for i, key := range keys {
+		prefix := m.prefix(key)
+		groups[prefix] = append(groups[prefix], i)
+	}
+	return groups
+}
@@ -0,0 +1,91 @@
+package cache_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/x_time"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recordSink struct {
+	observations []cache.Observation
+}
+
+func (r *recordSink) Observe(o cache.Observation) {
+	r.observations = append(r.observations, o)
+}
+
+func TestMetricsClient(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	memory := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+	defer memory.Stop()
+	sink := &recordSink{}
+	testClient(t, cache.NewMetricsClient(memory, sink, "key_", "m_"), clock.Advance)
+	type stat struct {
+		hits, misses, bytes int
+	}
+	got := map[string]stat{}
+	for _, o := range sink.observations {
+		s := got[o.Prefix+o.Op]
+		s.hits += o.Hits
+		s.misses += o.Misses
+		s.bytes += o.Bytes
+		got[o.Prefix+o.Op] = s
+	}
+	need := map[string]stat{
+		"key_get":  {hits: 2, misses: 1, bytes: 20},
+		"get":      {misses: 1},
+		"m_mget":   {hits: 2, bytes: 2},
+		"mget":     {misses: 1},
+		"key_set":  {bytes: 36},
+		"m_mset":   {bytes: 2},
+		"key_ttl":  {},
+		"delete":   {},
+		"m_delete": {},
+	}
+	for key, s := range need {
+		if got[key] != s {
+			t.Errorf("%s need: %+v, got: %+v\n", key, s, got[key])
+		}
+	}
+}
+
+func TestPrometheusSink(t *testing.T) {
+	ctx := context.Background()
+	memory := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer memory.Stop()
+	sink := cache.NewPrometheusSink("moon")
+	client := cache.NewMetricsClient(memory, sink, "recommenders_")
+	_ = client.Set(ctx, "recommenders_1", []byte("2"), 0)
+	_, _ = client.Get(ctx, "recommenders_1")
+	_, _ = client.Get(ctx, "recommenders_2")
+	// 负缓存单独统计，不计入命中
+	typed := cache.NewTyped(client, cache.JSON, 0)
+	_ = typed.SetNotFound(ctx, "recommenders_3", time.Minute)
+	var v int
+	_, _ = typed.Get(ctx, "recommenders_3", &v)
+	_, _ = typed.MGet(ctx, []string{"recommenders_1", "recommenders_3"}, func(i int) interface{} { return &v })
+	buf := &bytes.Buffer{}
+	_, err := sink.WriteTo(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"# TYPE moon_cache_requests_total counter",
+		`moon_cache_requests_total{prefix="recommenders_",op="get"} 3`,
+		`moon_cache_hits_total{prefix="recommenders_",op="get"} 1`,
+		`moon_cache_negative_hits_total{prefix="recommenders_",op="get"} 1`,
+		`moon_cache_misses_total{prefix="recommenders_",op="get"} 1`,
+		`moon_cache_hits_total{prefix="recommenders_",op="mget"} 1`,
+		`moon_cache_negative_hits_total{prefix="recommenders_",op="mget"} 1`,
+		`moon_cache_value_size_bytes_bucket{prefix="recommenders_",op="set",le="64"} 2`,
+		`moon_cache_operation_duration_seconds_count{prefix="recommenders_",op="get"} 3`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("need line: %s\n", line)
+		}
+	}
+}
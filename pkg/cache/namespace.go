@@ -0,0 +1,205 @@
+package cache
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/x_time"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 命名空间配置
+type NamespaceConfig struct {
+	MaxExpiration  time.Duration // 缓存最长过期时间，旧版本的缓存依赖过期时间自动清除，0 表示不限制，此时未设置过期时间的旧版本缓存将一直占用空间
+	VersionRefresh time.Duration // 本地缓存版本号的时间，其他实例升级版本后最多延迟该时间生效，0 表示每次操作都查询版本号
+	Clock          x_time.Clock  // 时钟，为空则使用系统时间
+}
+
+// 带版本号的前缀客户端，实际 key 为 namespace + 版本号 + ":" + key，版本号保存在 namespace + "version" 中。
+// 升级版本号后所有旧版本的 key 都将失效，无需遍历删除。版本号不能设置过期时间，
+// 也不能被缓存淘汰，否则版本号重置后旧版本的缓存可能重新生效
+type NamespaceClient struct {
+	namespace string
+	client    Client
+	config    NamespaceConfig
+	clock     x_time.Clock
+	version   int64
+	loadedAt  time.Time // 版本号加载时间
+	mu        sync.Mutex
+}
+
+func WithNamespaceClient(namespace string, client Client, config NamespaceConfig) *NamespaceClient {
+	return &NamespaceClient{
+		namespace: namespace,
+		client:    client,
+		config:    config,
+		clock:     x_time.Or(config.Clock),
+	}
+}
+
+// 获得当前版本号，版本号不存在则为 0
+func (n *NamespaceClient) Version(ctx context.Context) (int64, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	now := n.clock.Now()
+	if !n.loadedAt.IsZero() && now.Sub(n.loadedAt) < n.config.VersionRefresh {
+		return n.version, nil
+	}
+	data, err := n.client.Get(ctx, n.versionKey())
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	if len(data) > 0 {
+		version, err = strconv.ParseInt(string(data), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+	}
+	n.version, n.loadedAt = version, now
+	return version, nil
+}
+
+// 升级版本号，该命名空间下的所有缓存立即失效(其他实例最多延迟 VersionRefresh)，返回新版本号
+func (n *NamespaceClient) Bump(ctx context.Context) (int64, error) {
+	version, err := n.client.Incr(ctx, n.versionKey(), 1)
+	if err != nil {
+		return 0, err
+	}
+	n.mu.Lock()
+	n.version, n.loadedAt = version, n.clock.Now()
+	n.mu.Unlock()
+	return version, nil
+}
+
+func (n *NamespaceClient) versionKey() string {
+	return n.namespace + "version"
+}
+
+// 获得当前版本的前缀客户端
+func (n *NamespaceClient) current(ctx context.Context) (*prefixKeyClient, error) {
+	version, err := n.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &prefixKeyClient{
+		prefixKey: n.namespace + strconv.FormatInt(version, 10) + ":",
+		client:    n.client,
+	}, nil
+}
+
+// 限制过期时间不超过 MaxExpiration
+func (n *NamespaceClient) expiration(expiration time.Duration) time.Duration {
+	if n.config.MaxExpiration > 0 && (expiration <= 0 || expiration > n.config.MaxExpiration) {
+		return n.config.MaxExpiration
+	}
+	return expiration
+}
+
+func (n *NamespaceClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	c, err := n.current(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Set(ctx, key, value, n.expiration(expiration))
+}
+
+func (n *NamespaceClient) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return false, err
+	}
+	return c.SetNX(ctx, key, value, n.expiration(expiration))
+}
+
+func (n *NamespaceClient) Get(ctx context.Context, key string) (value []byte, err error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.Get(ctx, key)
+}
+
+func (n *NamespaceClient) Delete(ctx context.Context, keys ...string) error {
+	c, err := n.current(ctx)
+	if err != nil {
+		return err
+	}
+	return c.Delete(ctx, keys...)
+}
+
+func (n *NamespaceClient) Exists(ctx context.Context, key string) (bool, error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return false, err
+	}
+	return c.Exists(ctx, key)
+}
+
+func (n *NamespaceClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return c.TTL(ctx, key)
+}
+
+func (n *NamespaceClient) MGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return c.MGet(ctx, keys...)
+}
+
+func (n *NamespaceClient) mgetWithTTL(ctx context.Context, keys ...string) (values [][]byte, ttls []time.Duration, err error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return mgetWithTTL(ctx, c, keys...)
+}
+
+func (n *NamespaceClient) MSet(ctx context.Context, values map[string][]byte, expiration time.Duration) error {
+	c, err := n.current(ctx)
+	if err != nil {
+		return err
+	}
+	return c.MSet(ctx, values, n.expiration(expiration))
+}
+
+// 新建的计数器同样受 MaxExpiration 限制
+func (n *NamespaceClient) Incr(ctx context.Context, key string, value int64) (int64, error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return 0, err
+	}
+	result, err := c.Incr(ctx, key, value)
+	if err != nil {
+		return 0, err
+	}
+	if n.config.MaxExpiration > 0 {
+		ttl, err := c.TTL(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		if ttl == NoExpiration {
+			_, err = c.Expire(ctx, key, n.config.MaxExpiration)
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func (n *NamespaceClient) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	c, err := n.current(ctx)
+	if err != nil {
+		return false, err
+	}
+	if expiration > 0 {
+		expiration = n.expiration(expiration)
+	}
+	return c.Expire(ctx, key, expiration)
+}
@@ -0,0 +1,59 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/x_time"
+	"testing"
+	"time"
+)
+
+func TestNamespaceClient(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	memory := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+	defer memory.Stop()
+	testClient(t, cache.WithNamespaceClient("ns_", memory, cache.NamespaceConfig{Clock: clock}), clock.Advance)
+}
+
+func TestNamespaceClient_Bump(t *testing.T) {
+	ctx := context.Background()
+	clock := x_time.NewFake(time.Now())
+	memory := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+	defer memory.Stop()
+	config := cache.NamespaceConfig{MaxExpiration: time.Hour, VersionRefresh: time.Second, Clock: clock}
+	nodeA := cache.WithNamespaceClient(cache.HashTag("ns_"), memory, config)
+	nodeB := cache.WithNamespaceClient(cache.HashTag("ns_"), memory, config)
+
+	_ = nodeA.Set(ctx, "key", []byte("value"), 0)
+	ttl, _ := memory.TTL(ctx, "{ns_}0:key")
+	if ttl != time.Hour {
+		t.Errorf("ttl need: %v, got: %v\n", time.Hour, ttl)
+	}
+	value, _ := nodeB.Get(ctx, "key")
+	if string(value) != "value" {
+		t.Errorf("nodeB need: value, got: %s\n", value)
+	}
+	version, err := nodeA.Bump(ctx)
+	if err != nil || version != 1 {
+		t.Errorf("version need: 1, got: %d, %v\n", version, err)
+	}
+	value, _ = nodeA.Get(ctx, "key")
+	if value != nil {
+		t.Errorf("nodeA need: nil, got: %s\n", value)
+	}
+	// nodeB 在版本号刷新前仍读取旧版本
+	value, _ = nodeB.Get(ctx, "key")
+	if string(value) != "value" {
+		t.Errorf("nodeB need: value before refresh, got: %s\n", value)
+	}
+	clock.Advance(time.Second)
+	value, _ = nodeB.Get(ctx, "key")
+	if value != nil {
+		t.Errorf("nodeB need: nil after refresh, got: %s\n", value)
+	}
+	// 旧版本缓存自动过期
+	clock.Advance(time.Hour)
+	if exist, _ := memory.Exists(ctx, "{ns_}0:key"); exist {
+		t.Errorf("old generation need: expired\n")
+	}
+}
@@ -0,0 +1,202 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	// 默认操作耗时分布区间(秒)
+	DefaultLatencyBuckets = []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1}
+	// 默认数据大小分布区间(字节)
+	DefaultSizeBuckets = []float64{64, 256, 1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20}
+)
+
+// Prometheus 指标收集器，同时也是 http.Handler，可直接作为 /metrics 接口输出文本格式的指标
+type PrometheusSink struct {
+	namespace      string
+	latencyBuckets []float64
+	sizeBuckets    []float64
+	ops            map[opKey]*opMetrics
+	mu             sync.Mutex
+}
+
+type opKey struct {
+	prefix string
+	op     string
+}
+
+type opMetrics struct {
+	total        uint64
+	errors       uint64
+	hits         uint64
+	negativeHits uint64
+	misses       uint64
+	latency      *histogram
+	size         *histogram
+}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64 // 与 buckets 一一对应，非累计值
+	sum     float64
+	count   uint64
+}
+
+func (h *histogram) observe(v float64) {
+	for i, bound := range h.buckets {
+		if v <= bound {
+			h.counts[i]++
+			break
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// namespace 为指标名前缀，如 moon 将输出 moon_cache_requests_total 等指标，可以为空
+func NewPrometheusSink(namespace string) *PrometheusSink {
+	return &PrometheusSink{
+		namespace:      namespace,
+		latencyBuckets: DefaultLatencyBuckets,
+		sizeBuckets:    DefaultSizeBuckets,
+		ops:            map[opKey]*opMetrics{},
+	}
+}
+
+func (p *PrometheusSink) Observe(o Observation) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := opKey{prefix: o.Prefix, op: o.Op}
+	m := p.ops[key]
+	if m == nil {
+		m = &opMetrics{
+			latency: &histogram{buckets: p.latencyBuckets, counts: make([]uint64, len(p.latencyBuckets))},
+			size:    &histogram{buckets: p.sizeBuckets, counts: make([]uint64, len(p.sizeBuckets))},
+		}
+		p.ops[key] = m
+	}
+	m.total++
+	if o.Err != nil {
+		m.errors++
+	}
+	m.hits += uint64(o.Hits)
+	m.negativeHits += uint64(o.NegativeHits)
+	m.misses += uint64(o.Misses)
+	m.latency.observe(o.Latency.Seconds())
+	if o.Bytes > 0 {
+		m.size.observe(float64(o.Bytes))
+	}
+}
+
+// 以 Prometheus 文本格式输出所有指标
+func (p *PrometheusSink) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]opKey, 0, len(p.ops))
+	for key := range p.ops {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].prefix != keys[j].prefix {
+			return keys[i].prefix < keys[j].prefix
+		}
+		return keys[i].op < keys[j].op
+	})
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	counters := []struct {
+		name  string
+		help  string
+		value func(m *opMetrics) uint64
+	}{
+		{"cache_requests_total", "Total number of cache operations.", func(m *opMetrics) uint64 { return m.total }},
+		{"cache_errors_total", "Total number of failed cache operations.", func(m *opMetrics) uint64 { return m.errors }},
+		{"cache_hits_total", "Total number of keys found by read operations.", func(m *opMetrics) uint64 { return m.hits }},
+		{"cache_negative_hits_total", "Total number of keys found as cached not-found markers by read operations.", func(m *opMetrics) uint64 { return m.negativeHits }},
+		{"cache_misses_total", "Total number of keys not found by read operations.", func(m *opMetrics) uint64 { return m.misses }},
+	}
+	for _, c := range counters {
+		name := p.name(c.name)
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s counter\n", name, c.help, name)
+		for _, key := range keys {
+			fmt.Fprintf(cw, "%s{%s} %d\n", name, key.labels(), c.value(p.ops[key]))
+		}
+	}
+	histograms := []struct {
+		name  string
+		help  string
+		value func(m *opMetrics) *histogram
+	}{
+		{"cache_operation_duration_seconds", "Latency of cache operations.", func(m *opMetrics) *histogram { return m.latency }},
+		{"cache_value_size_bytes", "Size of values read or written.", func(m *opMetrics) *histogram { return m.size }},
+	}
+	for _, h := range histograms {
+		name := p.name(h.name)
+		fmt.Fprintf(cw, "# HELP %s %s\n# TYPE %s histogram\n", name, h.help, name)
+		for _, key := range keys {
+			hist := h.value(p.ops[key])
+			labels := key.labels()
+			var cumulative uint64
+			for i, bound := range hist.buckets {
+				cumulative += hist.counts[i]
+				fmt.Fprintf(cw, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, formatFloat(bound), cumulative)
+			}
+			fmt.Fprintf(cw, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, hist.count)
+			fmt.Fprintf(cw, "%s_sum{%s} %s\n", name, labels, formatFloat(hist.sum))
+			fmt.Fprintf(cw, "%s_count{%s} %d\n", name, labels, hist.count)
+		}
+	}
+	if cw.err != nil {
+		return cw.n, cw.err
+	}
+	return cw.n, cw.w.Flush()
+}
+
+func (p *PrometheusSink) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_, _ = p.WriteTo(w)
+}
+
+func (p *PrometheusSink) name(name string) string {
+	if p.namespace == "" {
+		return name
+	}
+	return p.namespace + "_" + name
+}
+
+func (k opKey) labels() string {
+	return "prefix=\"" + escapeLabel(k.prefix) + "\",op=\"" + escapeLabel(k.op) + "\""
+}
+
+var labelReplacer = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func escapeLabel(s string) string {
+	return labelReplacer.Replace(s)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// 记录写入字节数及第一个错误
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	if c.err != nil {
+		return 0, c.err
+	}
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	c.err = err
+	return n, err
+}
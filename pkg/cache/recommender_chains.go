@@ -0,0 +1,139 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/morgine/moon/pkg/rand"
+	"strconv"
+)
+
+var ErrRecommenderCycle = errors.New("cache: recommender chain contains a cycle")
+
+// 多级推荐人缓存，用户的推荐人链作为一条缓存保存。
+// 每个用户都有一个版本号，推荐人链同时保存链上各用户加载时的版本号，读取时版本号不一致则重新加载，
+// 因此用户的推荐人变化后只有包含该用户的推荐人链(该用户及其下级的链)失效
+type RecommenderChains struct {
+	namespace *NamespaceClient
+	loader    *Loader
+}
+
+// 推荐人链缓存，Versions[i] 为 members[i] 加载时的版本号，members 为用户本身及 Chain
+type recommenderChain struct {
+	Chain    []int
+	Versions []string
+}
+
+func NewRecommenderChains(namespace *NamespaceClient) *RecommenderChains {
+	return &RecommenderChains{
+		namespace: namespace,
+		loader:    NewLoader(NewTyped(namespace, JSON, 0), LoadOptions{}),
+	}
+}
+
+// 获得用户最多 depth 级的推荐人链，chain[0] 为直接推荐人，推荐人为 0 或不存在时结束，链中不包含不存在的用户。
+// 缓存不存在或已失效则通过 next 逐级加载，next 返回用户的直接推荐人，ok 为 false 表示用户不存在，
+// 推荐关系存在循环则返回 ErrRecommenderCycle
+func (rc *RecommenderChains) GetOrLoad(ctx context.Context, userID, depth int, next func(ctx context.Context, userID int) (recommenderID int, ok bool, err error)) (chain []int, err error) {
+	key := strconv.Itoa(userID) + "_" + strconv.Itoa(depth)
+	loaded := false
+	load := func(ctx context.Context) (interface{}, bool, error) {
+		loaded = true
+		rcc, err := rc.load(ctx, userID, depth, next)
+		return rcc, err == nil, err
+	}
+	rcc := &recommenderChain{}
+	_, err = rc.loader.GetOrLoad(ctx, key, rcc, load)
+	if err != nil || loaded {
+		return rcc.Chain, err
+	}
+	valid, err := rc.valid(ctx, userID, rcc)
+	if err != nil || valid {
+		return rcc.Chain, err
+	}
+	// 链上有用户的推荐人已变化，删除后重新加载，并发的调用者共享同一次加载
+	err = rc.loader.typed.Delete(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	rcc = &recommenderChain{}
+	_, err = rc.loader.GetOrLoad(ctx, key, rcc, load)
+	return rcc.Chain, err
+}
+
+// 使包含这些用户的推荐人链失效，用户的推荐人变化后需要调用
+func (rc *RecommenderChains) Invalidate(ctx context.Context, userIDs ...int) error {
+	values := make(map[string][]byte, len(userIDs))
+	for _, userID := range userIDs {
+		// 版本号使用随机值，版本号过期或被淘汰后也不会与旧版本号相同
+		values[versionKey(userID)] = []byte(rand.Str(16))
+	}
+	return rc.namespace.MSet(ctx, values, 0)
+}
+
+// 使所有推荐人链失效，用于批量修改推荐关系后(如数据迁移)
+func (rc *RecommenderChains) InvalidateAll(ctx context.Context) error {
+	_, err := rc.namespace.Bump(ctx)
+	return err
+}
+
+func versionKey(userID int) string {
+	return "version_" + strconv.Itoa(userID)
+}
+
+// 链上各用户当前的版本号是否与加载时一致
+func (rc *RecommenderChains) valid(ctx context.Context, userID int, rcc *recommenderChain) (bool, error) {
+	members := append([]int{userID}, rcc.Chain...)
+	if len(rcc.Versions) > len(members) {
+		return false, nil
+	}
+	keys := make([]string, len(rcc.Versions))
+	for i := range rcc.Versions {
+		keys[i] = versionKey(members[i])
+	}
+	versions, err := rc.namespace.MGet(ctx, keys...)
+	if err != nil {
+		return false, err
+	}
+	for i, version := range versions {
+		if string(version) != rcc.Versions[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// 逐级加载推荐人链，查询用户的推荐人之前先读取该用户的版本号，
+// 读取之后发生的推荐人变化会使版本号不一致，从而不会缓存过期的推荐关系
+func (rc *RecommenderChains) load(ctx context.Context, userID, depth int, next func(ctx context.Context, userID int) (int, bool, error)) (*recommenderChain, error) {
+	rcc := &recommenderChain{Chain: []int{}}
+	visited := map[int]bool{userID: true}
+	for current := userID; len(rcc.Chain) < depth; {
+		version, err := rc.namespace.Get(ctx, versionKey(current))
+		if err != nil {
+			return nil, err
+		}
+		rcc.Versions = append(rcc.Versions, string(version))
+		recommenderID, ok, err := next(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			// 推荐人不存在(如已被删除)时返回已加载的部分，链中不包含不存在的用户
+			if len(rcc.Chain) > 0 {
+				rcc.Chain = rcc.Chain[:len(rcc.Chain)-1]
+				rcc.Versions = rcc.Versions[:len(rcc.Versions)-1]
+			}
+			break
+		}
+		if recommenderID == 0 {
+			break
+		}
+		if visited[recommenderID] {
+			return nil, ErrRecommenderCycle
+		}
+		visited[recommenderID] = true
+		rcc.Chain = append(rcc.Chain, recommenderID)
+		current = recommenderID
+	}
+	return rcc, nil
+}
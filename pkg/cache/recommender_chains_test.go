@@ -0,0 +1,71 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"reflect"
+	"testing"
+)
+
+func TestRecommenderChains(t *testing.T) {
+	ctx := context.Background()
+	memory := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer memory.Stop()
+	chains := cache.NewRecommenderChains(cache.WithNamespaceClient("chains_", memory, cache.NamespaceConfig{}))
+	// 用户 ID => 推荐人 ID，用户 9 不存在
+	recommenders := map[int]int{1: 0, 2: 1, 3: 2, 4: 3, 5: 6, 6: 5, 7: 8, 8: 9}
+	loads := 0
+	next := func(ctx context.Context, userID int) (int, bool, error) {
+		loads++
+		recommenderID, ok := recommenders[userID]
+		return recommenderID, ok, nil
+	}
+	type testcase struct {
+		userID int
+		depth  int
+		chain  []int
+		err    error
+	}
+	var testcases = []testcase{
+		{userID: 4, depth: 10, chain: []int{3, 2, 1}},
+		{userID: 4, depth: 2, chain: []int{3, 2}},
+		{userID: 1, depth: 10, chain: []int{}},
+		{userID: 5, depth: 10, err: cache.ErrRecommenderCycle},
+		{userID: 7, depth: 10, chain: []int{8}},
+		{userID: 9, depth: 10, chain: []int{}},
+	}
+	for _, tc := range testcases {
+		chain, err := chains.GetOrLoad(ctx, tc.userID, tc.depth, next)
+		if err != tc.err {
+			t.Errorf("%d need error: %v, got: %v\n", tc.userID, tc.err, err)
+		}
+		if err == nil && !reflect.DeepEqual(chain, tc.chain) {
+			t.Errorf("%d need: %v, got: %v\n", tc.userID, tc.chain, chain)
+		}
+	}
+	// 命中缓存不再加载
+	loads = 0
+	_, _ = chains.GetOrLoad(ctx, 4, 10, next)
+	_, _ = chains.GetOrLoad(ctx, 7, 10, next)
+	if loads != 0 {
+		t.Errorf("loads need: 0, got: %d\n", loads)
+	}
+	// 推荐关系变化后只有包含该用户的链重新加载
+	recommenders[2] = 0
+	_ = chains.Invalidate(ctx, 2)
+	chain, _ := chains.GetOrLoad(ctx, 4, 10, next)
+	if need := []int{3, 2}; !reflect.DeepEqual(chain, need) {
+		t.Errorf("need: %v, got: %v\n", need, chain)
+	}
+	loads = 0
+	chain, _ = chains.GetOrLoad(ctx, 7, 10, next)
+	if need := []int{8}; loads != 0 || !reflect.DeepEqual(chain, need) {
+		t.Errorf("unrelated chain need: %v without loads, got: %v %d loads\n", need, chain, loads)
+	}
+	// 全部失效
+	recommenders[2] = 4
+	_ = chains.InvalidateAll(ctx)
+	if _, err := chains.GetOrLoad(ctx, 4, 10, next); err != cache.ErrRecommenderCycle {
+		t.Errorf("need error: %v, got: %v\n", cache.ErrRecommenderCycle, err)
+	}
+}
@@ -1,34 +1,71 @@
 package cache
 
-import "strconv"
+import (
+	"context"
+	"strconv"
+	"time"
+)
 
 type Recommenders struct {
-	client Client
+	typed  *Typed
+	loader *Loader
 }
 
-func NewRecommenders(client Client) *Recommenders {
-	return &Recommenders{client: client}
+// notFoundExpiration 为不存在的用户的缓存时间，0 表示不缓存不存在的用户
+func NewRecommenders(client Client, notFoundExpiration time.Duration) *Recommenders {
+	typed := NewTyped(client, JSON, 0)
+	return &Recommenders{
+		typed:  typed,
+		loader: NewLoader(typed, LoadOptions{NotFoundExpiration: notFoundExpiration}),
+	}
+}
+
+// 获得推荐人缓存，ok 为 false 表示缓存不存在
+func (rs *Recommenders) Get(ctx context.Context, userID int) (recommenderID int, ok bool, err error) {
+	ok, err = rs.typed.Get(ctx, strconv.Itoa(userID), &recommenderID)
+	return recommenderID, ok, err
+}
+
+// 获得推荐人缓存，缓存不存在则通过 load 加载，ok 为 false 表示用户不存在
+func (rs *Recommenders) GetOrLoad(ctx context.Context, userID int, load func(ctx context.Context) (recommenderID int, ok bool, err error)) (recommenderID int, ok bool, err error) {
+	ok, err = rs.loader.GetOrLoad(ctx, strconv.Itoa(userID), &recommenderID, func(ctx context.Context) (interface{}, bool, error) {
+		return load(ctx)
+	})
+	return recommenderID, ok, err
+}
+
+// 设置推荐人缓存
+func (rs *Recommenders) Set(ctx context.Context, userID, recommenderID int) error {
+	return rs.typed.Set(ctx, strconv.Itoa(userID), recommenderID)
 }
 
-// 获得推荐人缓存，recommenderID 小于 0 则表示缓存不存在，否则表示缓存存在
-func (rs *Recommenders) Get(userID int) (recommenderID int, err error) {
-	data, err := rs.client.Get(strconv.Itoa(userID))
+// 批量获得推荐人缓存，返回已缓存的用户 ID 及推荐人 ID，未缓存的用户不在结果中
+func (rs *Recommenders) MGet(ctx context.Context, userIDs ...int) (recommenderIDs map[int]int, err error) {
+	ids := make([]int, len(userIDs))
+	found, err := rs.typed.MGet(ctx, userKeys(userIDs), func(i int) interface{} {
+		return &ids[i]
+	})
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
-	if len(data) > 0 {
-		recommenderID, err = strconv.Atoi(string(data))
-		if err != nil {
-			return 0, err
-		} else {
-			return recommenderID, nil
+	recommenderIDs = make(map[int]int, len(userIDs))
+	for i, ok := range found {
+		if ok {
+			recommenderIDs[userIDs[i]] = ids[i]
 		}
-	} else {
-		return -1, nil
 	}
+	return recommenderIDs, nil
 }
 
-// 设置推荐人缓存
-func (rs Recommenders) Set(userID, recommenderID int) error {
-	return rs.client.Set(strconv.Itoa(userID), []byte(strconv.Itoa(recommenderID)), 0)
+// 删除推荐人缓存，推荐人变更后需要删除缓存
+func (rs *Recommenders) Delete(ctx context.Context, userIDs ...int) error {
+	return rs.typed.Delete(ctx, userKeys(userIDs)...)
+}
+
+func userKeys(userIDs []int) []string {
+	keys := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		keys[i] = strconv.Itoa(userID)
+	}
+	return keys
 }
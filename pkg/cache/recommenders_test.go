@@ -0,0 +1,41 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRecommenders(t *testing.T) {
+	ctx := context.Background()
+	client := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer client.Stop()
+	rs := cache.NewRecommenders(cache.WithPrefixClient("recommenders_", client), time.Minute)
+	_ = rs.Set(ctx, 1, 0)
+	_ = rs.Set(ctx, 2, 1)
+	_ = rs.Set(ctx, 3, 2)
+	err := rs.Delete(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recommenderID, ok, err := rs.Get(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || recommenderID != 1 {
+		t.Errorf("user 2 need: 1, true, got: %d, %t\n", recommenderID, ok)
+	}
+	_, ok, _ = rs.Get(ctx, 3)
+	if ok {
+		t.Errorf("user 3 need: not found\n")
+	}
+	ids, err := rs.MGet(ctx, 1, 2, 3, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if need := map[int]int{1: 0, 2: 1}; !reflect.DeepEqual(ids, need) {
+		t.Errorf("need: %v, got: %v\n", need, ids)
+	}
+}
@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/x_time"
+)
+
+// Redis 部署模式
+const (
+	RedisStandalone = "standalone" // 单节点
+	RedisSentinel   = "sentinel"   // 哨兵
+	RedisCluster    = "cluster"    // 集群
+)
+
+/*
+# redis 缓存配置
+[cache]
+# 部署模式: standalone(默认)、sentinel、cluster
+mode = "sentinel"
+# standalone 模式为 redis 地址，sentinel 模式为哨兵地址，cluster 模式为集群节点地址
+addrs = ["localhost:26379", "localhost:26380"]
+# sentinel 模式下的主节点名称
+master_name = "mymaster"
+# redis 密码
+password = ""
+# 哨兵密码
+sentinel_password = ""
+# db 索引，cluster 模式只能为 0
+db = 0
+# 超时时间，使用 "5s"、"500ms" 等格式，不设置则使用 go-redis 默认值
+dial_timeout = "5s"
+read_timeout = "3s"
+write_timeout = "3s"
+*/
+type RedisConfig struct {
+	Mode             string          `toml:"mode"`
+	Addrs            []string        `toml:"addrs"`
+	MasterName       string          `toml:"master_name"`
+	Username         string          `toml:"username"`
+	Password         string          `toml:"password"`
+	SentinelPassword string          `toml:"sentinel_password"`
+	DB               int             `toml:"db"`
+	PoolSize         int             `toml:"pool_size"`     // 连接池大小，0 表示使用 go-redis 默认值
+	DialTimeout      x_time.Duration `toml:"dial_timeout"`  // 连接超时时间，0 表示使用 go-redis 默认值
+	ReadTimeout      x_time.Duration `toml:"read_timeout"`  // 读超时时间，0 表示使用 go-redis 默认值
+	WriteTimeout     x_time.Duration `toml:"write_timeout"` // 写超时时间，0 表示使用 go-redis 默认值
+}
+
+// 根据部署模式创建客户端并检测连接
+func (c RedisConfig) Connect() (redis.UniversalClient, error) {
+	client, err := c.NewClient()
+	if err != nil {
+		return nil, err
+	}
+	err = client.Ping(context.Background()).Err()
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// 根据部署模式创建客户端，不检测连接
+func (c RedisConfig) NewClient() (redis.UniversalClient, error) {
+	if len(c.Addrs) == 0 {
+		return nil, errors.New("cache: redis addrs is empty")
+	}
+	opts := &redis.UniversalOptions{
+		Addrs:            c.Addrs,
+		MasterName:       c.MasterName,
+		Username:         c.Username,
+		Password:         c.Password,
+		SentinelPassword: c.SentinelPassword,
+		DB:               c.DB,
+		PoolSize:         c.PoolSize,
+		DialTimeout:      c.DialTimeout.Duration(),
+		ReadTimeout:      c.ReadTimeout.Duration(),
+		WriteTimeout:     c.WriteTimeout.Duration(),
+	}
+	switch c.Mode {
+	case "", RedisStandalone:
+		return redis.NewClient(opts.Simple()), nil
+	case RedisSentinel:
+		if c.MasterName == "" {
+			return nil, errors.New("cache: redis sentinel mode requires master_name")
+		}
+		return redis.NewFailoverClient(opts.Failover()), nil
+	case RedisCluster:
+		if c.DB != 0 {
+			return nil, errors.New("cache: redis cluster mode only supports db 0")
+		}
+		return redis.NewClusterClient(opts.Cluster()), nil
+	default:
+		return nil, errors.New("cache: unknown redis mode " + c.Mode)
+	}
+}
+
+// 为前缀添加 hash tag，集群模式下相同 hash tag 的 key 位于同一个 slot，
+// 因此 MGet、MSet、Delete 等多 key 操作不会出现 CROSSSLOT 错误，如 WithPrefixClient(HashTag("recommenders_"), client)
+func HashTag(prefix string) string {
+	return "{" + prefix + "}"
+}
@@ -0,0 +1,75 @@
+package cache_test
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/cache"
+	"testing"
+	"time"
+)
+
+func TestRedisConfig(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client, err := cache.RedisConfig{Addrs: []string{mr.Addr()}}.Connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	if _, ok := client.(*redis.Client); !ok {
+		t.Errorf("standalone need: *redis.Client, got: %T\n", client)
+	}
+
+	type testcase struct {
+		config  cache.RedisConfig
+		isError bool
+	}
+	var testcases = []testcase{
+		{config: cache.RedisConfig{}, isError: true},
+		{config: cache.RedisConfig{Mode: cache.RedisSentinel, Addrs: []string{mr.Addr()}}, isError: true},
+		{config: cache.RedisConfig{Mode: cache.RedisSentinel, Addrs: []string{mr.Addr()}, MasterName: "master"}},
+		{config: cache.RedisConfig{Mode: cache.RedisCluster, Addrs: []string{mr.Addr()}, DB: 1}, isError: true},
+		{config: cache.RedisConfig{Mode: cache.RedisCluster, Addrs: []string{mr.Addr()}}},
+		{config: cache.RedisConfig{Mode: "unknown", Addrs: []string{mr.Addr()}}, isError: true},
+	}
+	for _, tc := range testcases {
+		client, err := tc.config.NewClient()
+		if (err != nil) != tc.isError {
+			t.Errorf("%+v need error: %t, got: %v\n", tc.config, tc.isError, err)
+		}
+		if client != nil {
+			_ = client.Close()
+		}
+	}
+}
+
+func TestRedisConfig_TOML(t *testing.T) {
+	// RedisConfig 文档中的配置示例
+	var config struct {
+		Cache cache.RedisConfig `toml:"cache"`
+	}
+	_, err := toml.Decode(`
+[cache]
+mode = "sentinel"
+addrs = ["localhost:26379", "localhost:26380"]
+master_name = "mymaster"
+password = ""
+sentinel_password = ""
+db = 0
+dial_timeout = "5s"
+read_timeout = "3s"
+write_timeout = "3s"
+`, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := config.Cache
+	if c.Mode != cache.RedisSentinel || len(c.Addrs) != 2 || c.DialTimeout.Duration() != 5*time.Second ||
+		c.ReadTimeout.Duration() != 3*time.Second || c.WriteTimeout.Duration() != 3*time.Second {
+		t.Errorf("got: %+v\n", c)
+	}
+}
@@ -0,0 +1,37 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/cache"
+	"testing"
+	"time"
+)
+
+func TestRedisClient(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	testClient(t, cache.NewRedisClient(client, time.Second), mr.FastForward)
+}
+
+func TestRedisClient_Canceled(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = cache.NewRedisClient(client, time.Second).Get(ctx, "key")
+	if err != context.Canceled {
+		t.Errorf("need: %v, got: %v\n", context.Canceled, err)
+	}
+}
@@ -0,0 +1,287 @@
+package cache
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/x_time"
+	"sync"
+	"time"
+)
+
+// 二级缓存配置
+type TieredConfig struct {
+	MaxEntries      int           // 本地缓存最大条数，超出后淘汰最久未使用的数据，0 表示不限制
+	LocalExpiration time.Duration // 本地缓存时间上限，用于限制丢失失效通知(如网络中断)时读到旧数据的时间，0 表示不限制
+	SweepInterval   time.Duration // 本地缓存后台清理过期数据的间隔，0 表示不启动后台清理
+	Clock           x_time.Clock  // 本地缓存的时钟，为空则使用系统时间
+}
+
+// 二级缓存客户端，在远程缓存(L2)之前增加一层进程内缓存(L1)。
+// 写入及删除操作会通过 Invalidator 通知其他实例删除本地缓存，Exists 及 TTL 直接查询远程缓存
+// 从远程缓存读取或写入期间收到失效通知或其他写入的 key 不写入本地缓存，避免旧数据在本地缓存中长期有效
+type TieredClient struct {
+	config      TieredConfig
+	local       *MemoryClient
+	remote      Client
+	invalidator Invalidator
+	fills       map[string]*fillState // 正在从远程缓存读取的 key
+	mu          sync.Mutex
+}
+
+// 从远程缓存读取或写入 key 期间的失效状态
+type fillState struct {
+	readers int    // 正在读取或写入该 key 的请求数
+	version uint64 // 失效次数，读取前后不一致说明读取期间收到了失效通知或写入，读到的数据可能已过时
+}
+
+// invalidator 为 nil 时不广播失效通知，仅适用于单实例部署
+func NewTieredClient(remote Client, invalidator Invalidator, config TieredConfig) (*TieredClient, error) {
+	t := &TieredClient{
+		config: config,
+		local: NewMemoryClient(MemoryConfig{
+			MaxEntries:    config.MaxEntries,
+			SweepInterval: config.SweepInterval,
+			Clock:         config.Clock,
+		}),
+		remote:      remote,
+		invalidator: invalidator,
+		fills:       map[string]*fillState{},
+	}
+	if invalidator != nil {
+		err := invalidator.Subscribe(context.Background(), func(keys []string) {
+			t.invalidate(context.Background(), keys...)
+		})
+		if err != nil {
+			t.local.Stop()
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+func (t *TieredClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	version := t.beginFill(key)
+	err := t.remote.Set(ctx, key, value, expiration)
+	if err != nil {
+		t.endFill(ctx, key, version, nil, KeyNotExist)
+		return err
+	}
+	version = t.invalidateFill(ctx, key, version)
+	err = t.publish(ctx, key)
+	if err != nil {
+		t.endFill(ctx, key, version, nil, KeyNotExist)
+		return err
+	}
+	t.endFill(ctx, key, version, value, expirationTTL(expiration))
+	return nil
+}
+
+func (t *TieredClient) SetNX(ctx context.Context, key string, value []byte, expiration time.Duration) (bool, error) {
+	ok, err := t.remote.SetNX(ctx, key, value, expiration)
+	if err != nil || !ok {
+		return ok, err
+	}
+	// 远程缓存写入前不存在，本地缓存中的数据(如有)已失效
+	t.invalidate(ctx, key)
+	return true, t.publish(ctx, key)
+}
+
+func (t *TieredClient) Get(ctx context.Context, key string) (value []byte, err error) {
+	value, _ = t.local.Get(ctx, key)
+	if value != nil {
+		return value, nil
+	}
+	version := t.beginFill(key)
+	values, ttls, err := mgetWithTTL(ctx, t.remote, key)
+	if err != nil {
+		t.endFill(ctx, key, version, nil, KeyNotExist)
+		return nil, err
+	}
+	t.endFill(ctx, key, version, values[0], ttls[0])
+	return values[0], nil
+}
+
+func (t *TieredClient) Delete(ctx context.Context, keys ...string) error {
+	err := t.remote.Delete(ctx, keys...)
+	// 删除失败时远程缓存的状态未知，同样删除本地缓存
+	t.invalidate(ctx, keys...)
+	if err != nil {
+		return err
+	}
+	return t.publish(ctx, keys...)
+}
+
+func (t *TieredClient) Exists(ctx context.Context, key string) (bool, error) {
+	return t.remote.Exists(ctx, key)
+}
+
+func (t *TieredClient) TTL(ctx context.Context, key string) (time.Duration, error) {
+	return t.remote.TTL(ctx, key)
+}
+
+func (t *TieredClient) MGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	values, _ = t.local.MGet(ctx, keys...)
+	var missKeys []string
+	var missIdx []int
+	for i, value := range values {
+		if value == nil {
+			missKeys = append(missKeys, keys[i])
+			missIdx = append(missIdx, i)
+		}
+	}
+	if len(missKeys) == 0 {
+		return values, nil
+	}
+	versions := make([]uint64, len(missKeys))
+	for i, key := range missKeys {
+		versions[i] = t.beginFill(key)
+	}
+	remoteValues, ttls, err := mgetWithTTL(ctx, t.remote, missKeys...)
+	for i, key := range missKeys {
+		if err != nil {
+			t.endFill(ctx, key, versions[i], nil, KeyNotExist)
+			continue
+		}
+		values[missIdx[i]] = remoteValues[i]
+		t.endFill(ctx, key, versions[i], remoteValues[i], ttls[i])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+func (t *TieredClient) MSet(ctx context.Context, values map[string][]byte, expiration time.Duration) error {
+	keys := make([]string, 0, len(values))
+	versions := make([]uint64, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+		versions = append(versions, t.beginFill(key))
+	}
+	err := t.remote.MSet(ctx, values, expiration)
+	if err == nil {
+		for i, key := range keys {
+			versions[i] = t.invalidateFill(ctx, key, versions[i])
+		}
+		err = t.publish(ctx, keys...)
+	}
+	ttl := expirationTTL(expiration)
+	for i, key := range keys {
+		if err != nil {
+			t.endFill(ctx, key, versions[i], nil, KeyNotExist)
+		} else {
+			t.endFill(ctx, key, versions[i], values[key], ttl)
+		}
+	}
+	return err
+}
+
+func (t *TieredClient) Incr(ctx context.Context, key string, value int64) (int64, error) {
+	n, err := t.remote.Incr(ctx, key, value)
+	t.invalidate(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	return n, t.publish(ctx, key)
+}
+
+func (t *TieredClient) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	ok, err := t.remote.Expire(ctx, key, expiration)
+	t.invalidate(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return ok, t.publish(ctx, key)
+}
+
+// 停止本地缓存清理及失效通知订阅
+func (t *TieredClient) Close() error {
+	t.local.Stop()
+	if t.invalidator != nil {
+		return t.invalidator.Close()
+	}
+	return nil
+}
+
+// 通知其他实例删除本地缓存
+func (t *TieredClient) publish(ctx context.Context, keys ...string) error {
+	if t.invalidator == nil || len(keys) == 0 {
+		return nil
+	}
+	return t.invalidator.Publish(ctx, keys)
+}
+
+// 开始从远程缓存读取或写入 key，返回当前的失效版本
+func (t *TieredClient) beginFill(key string) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.fills[key]
+	if state == nil {
+		state = &fillState{}
+		t.fills[key] = state
+	}
+	state.readers++
+	return state.version
+}
+
+// 结束从远程缓存读取或写入 key，value 不为 nil 且期间未失效时将数据写入本地缓存。
+// ttl 为远程缓存的剩余过期时间，含义与 Client.TTL 相同，本地缓存不会晚于远程缓存过期
+func (t *TieredClient) endFill(ctx context.Context, key string, version uint64, value []byte, ttl time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.fills[key]
+	state.readers--
+	if state.readers == 0 {
+		delete(t.fills, key)
+	}
+	if state.version != version || value == nil || ttl == KeyNotExist {
+		return
+	}
+	if ttl == NoExpiration {
+		ttl = 0
+	}
+	// 持有锁写入，保证失效操作不会插入在版本检查与写入之间
+	_ = t.local.Set(ctx, key, value, t.localExpiration(ttl))
+}
+
+// 删除本地缓存，正在从远程缓存读取这些 key 的请求不再写入本地缓存
+func (t *TieredClient) invalidate(ctx context.Context, keys ...string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, key := range keys {
+		if state := t.fills[key]; state != nil {
+			state.version++
+		}
+	}
+	_ = t.local.Delete(ctx, keys...)
+}
+
+// 写入远程缓存后删除本地缓存，并使其他正在读取或写入该 key 的请求不再写入本地缓存，返回写入者结束时使用的版本。
+// 写入期间已经收到失效通知或其他写入时无法确定先后顺序，返回的版本与当前版本不一致，写入者同样不再写入本地缓存
+func (t *TieredClient) invalidateFill(ctx context.Context, key string, version uint64) uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	state := t.fills[key]
+	stale := state.version != version
+	state.version++
+	_ = t.local.Delete(ctx, key)
+	if stale {
+		return version
+	}
+	return state.version
+}
+
+// 写入时的过期时间转换为 TTL，小于等于 0 表示未设置过期时间
+func expirationTTL(expiration time.Duration) time.Duration {
+	if expiration <= 0 {
+		return NoExpiration
+	}
+	return expiration
+}
+
+// 本地缓存时间不超过远程缓存时间及 LocalExpiration
+func (t *TieredClient) localExpiration(expiration time.Duration) time.Duration {
+	if t.config.LocalExpiration > 0 && (expiration <= 0 || expiration > t.config.LocalExpiration) {
+		return t.config.LocalExpiration
+	}
+	return expiration
+}
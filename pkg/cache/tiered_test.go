@@ -0,0 +1,240 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/x_time"
+	"testing"
+	"time"
+)
+
+// clock 为 nil 时本地缓存使用系统时间
+func newTieredClient(t *testing.T, client *redis.Client, clock x_time.Clock) *cache.TieredClient {
+	tiered, err := cache.NewTieredClient(
+		cache.NewRedisClient(client, time.Second),
+		cache.NewRedisInvalidator(client, "cache_invalidation"),
+		cache.TieredConfig{MaxEntries: 100, LocalExpiration: time.Hour, Clock: clock},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tiered
+}
+
+func TestTieredClient(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	clock := x_time.NewFake(time.Now())
+	tiered := newTieredClient(t, client, clock)
+	defer tiered.Close()
+	testClient(t, tiered, func(d time.Duration) {
+		mr.FastForward(d)
+		clock.Advance(d)
+	})
+}
+
+func TestTieredClient_Invalidation(t *testing.T) {
+	ctx := context.Background()
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	nodeA := newTieredClient(t, client, nil)
+	defer nodeA.Close()
+	nodeB := newTieredClient(t, client, nil)
+	defer nodeB.Close()
+
+	// 直接写入远程缓存，避免 nodeA 的失效通知在 nodeB 读取期间到达
+	mr.Set("key", "v1")
+	// nodeB 读取后写入本地缓存
+	value, _ := nodeB.Get(ctx, "key")
+	if string(value) != "v1" {
+		t.Fatalf("need: v1, got: %s\n", value)
+	}
+	// 直接修改远程缓存，本地缓存仍然有效
+	mr.Set("key", "v2")
+	value, _ = nodeB.Get(ctx, "key")
+	if string(value) != "v1" {
+		t.Errorf("need local value: v1, got: %s\n", value)
+	}
+	// nodeA 删除后 nodeB 收到失效通知
+	_ = nodeA.Delete(ctx, "key")
+	waitFor(func() bool {
+		value, _ = nodeB.Get(ctx, "key")
+		return value == nil
+	})
+	if value != nil {
+		t.Errorf("need: nil, got: %s\n", value)
+	}
+	// nodeA 写入后 nodeB 读取到新值
+	_ = nodeB.Set(ctx, "key", []byte("v3"), 0)
+	_ = nodeA.Set(ctx, "key", []byte("v4"), 0)
+	waitFor(func() bool {
+		value, _ = nodeB.Get(ctx, "key")
+		return string(value) == "v4"
+	})
+	if string(value) != "v4" {
+		t.Errorf("need: v4, got: %s\n", value)
+	}
+}
+
+// 读取时阻塞的远程缓存，用于模拟读取期间收到失效通知
+type blockingClient struct {
+	cache.Client
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingClient) MGet(ctx context.Context, keys ...string) (values [][]byte, err error) {
+	values, err = b.Client.MGet(ctx, keys...)
+	close(b.read)
+	<-b.release
+	return values, err
+}
+
+// 手动触发失效通知的通知器
+type manualInvalidator struct {
+	handler func(keys []string)
+}
+
+func (m *manualInvalidator) Publish(ctx context.Context, keys []string) error {
+	return nil
+}
+
+func (m *manualInvalidator) Subscribe(ctx context.Context, handler func(keys []string)) error {
+	m.handler = handler
+	return nil
+}
+
+func (m *manualInvalidator) Close() error {
+	return nil
+}
+
+func TestTieredClient_InvalidationDuringFill(t *testing.T) {
+	ctx := context.Background()
+	memory := cache.NewMemoryClient(cache.MemoryConfig{})
+	_ = memory.Set(ctx, "key", []byte("v1"), 0)
+	remote := &blockingClient{Client: memory, read: make(chan struct{}), release: make(chan struct{})}
+	invalidator := &manualInvalidator{}
+	tiered, err := cache.NewTieredClient(remote, invalidator, cache.TieredConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiered.Close()
+	done := make(chan []byte)
+	go func() {
+		value, _ := tiered.Get(ctx, "key")
+		done <- value
+	}()
+	// 读取到 v1 后其他实例写入 v2 并广播失效通知
+	<-remote.read
+	_ = memory.Set(ctx, "key", []byte("v2"), 0)
+	invalidator.handler([]string{"key"})
+	close(remote.release)
+	if value := <-done; string(value) != "v1" {
+		t.Fatalf("need: v1, got: %s\n", value)
+	}
+	// 读取期间已失效的 v1 不能写入本地缓存
+	remote.read, remote.release = make(chan struct{}), make(chan struct{})
+	close(remote.release)
+	value, _ := tiered.Get(ctx, "key")
+	if string(value) != "v2" {
+		t.Errorf("need: v2, got: %s\n", value)
+	}
+}
+
+// 等待异步条件成立，最多等待 1 秒
+func waitFor(condition func() bool) {
+	for i := 0; i < 100 && !condition(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 写入时阻塞的远程缓存，用于模拟写入期间收到失效通知
+type blockingSetClient struct {
+	cache.Client
+	written chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingSetClient) Set(ctx context.Context, key string, value []byte, expiration time.Duration) error {
+	err := b.Client.Set(ctx, key, value, expiration)
+	close(b.written)
+	<-b.release
+	return err
+}
+
+func TestTieredClient_InvalidationDuringSet(t *testing.T) {
+	ctx := context.Background()
+	memory := cache.NewMemoryClient(cache.MemoryConfig{})
+	remote := &blockingSetClient{Client: memory, written: make(chan struct{}), release: make(chan struct{})}
+	invalidator := &manualInvalidator{}
+	tiered, err := cache.NewTieredClient(remote, invalidator, cache.TieredConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiered.Close()
+	done := make(chan error)
+	go func() {
+		done <- tiered.Set(ctx, "key", []byte("v1"), 0)
+	}()
+	// 写入 v1 后其他实例写入 v2 并广播失效通知
+	<-remote.written
+	_ = memory.Set(ctx, "key", []byte("v2"), 0)
+	invalidator.handler([]string{"key"})
+	close(remote.release)
+	if err = <-done; err != nil {
+		t.Fatal(err)
+	}
+	// 无法确定先后顺序的 v1 不能写入本地缓存
+	value, _ := tiered.Get(ctx, "key")
+	if string(value) != "v2" {
+		t.Errorf("need: v2, got: %s\n", value)
+	}
+}
+
+func TestTieredClient_FillTTL(t *testing.T) {
+	ctx := context.Background()
+	clock := x_time.NewFake(time.Now())
+	memory := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+	defer memory.Stop()
+	sink := &recordSink{}
+	tiered, err := cache.NewTieredClient(cache.NewMetricsClient(memory, sink), nil, cache.TieredConfig{Clock: clock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tiered.Close()
+	_ = memory.Set(ctx, "key", []byte("v1"), time.Minute)
+	_ = memory.Set(ctx, "forever", []byte("v2"), 0)
+	_, _ = tiered.Get(ctx, "key")
+	_, _ = tiered.MGet(ctx, "forever", "missing")
+	// 读取远程缓存时同时获得过期时间，不再额外查询 TTL
+	for _, o := range sink.observations {
+		if o.Op != "mget" {
+			t.Errorf("remote op need: mget, got: %s\n", o.Op)
+		}
+	}
+	// 本地缓存与远程缓存同时过期
+	_ = memory.Set(ctx, "key", []byte("v3"), time.Hour)
+	_ = memory.Set(ctx, "forever", []byte("v4"), 0)
+	if value, _ := tiered.Get(ctx, "key"); string(value) != "v1" {
+		t.Errorf("need: v1 from local, got: %s\n", value)
+	}
+	clock.Advance(time.Minute)
+	if value, _ := tiered.Get(ctx, "key"); string(value) != "v3" {
+		t.Errorf("need: v3 after expired, got: %s\n", value)
+	}
+	if value, _ := tiered.Get(ctx, "forever"); string(value) != "v2" {
+		t.Errorf("need: v2 from local, got: %s\n", value)
+	}
+}
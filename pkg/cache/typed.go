@@ -0,0 +1,113 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Typed 写入的数据均以标记字节开头，编码后的数据(如 Raw 编码的任意字节)不会与负缓存冲突
+const (
+	notFoundFlag byte = 0 // 负缓存，表示数据源中不存在该数据
+	valueFlag    byte = 1 // 之后为编码后的数据
+)
+
+// 负缓存标记
+var notFoundMarker = []byte{notFoundFlag}
+
+// 带编解码器的缓存，可直接存取结构体等任意类型的数据
+type Typed struct {
+	client     Client
+	codec      Codec
+	expiration time.Duration
+}
+
+// expiration 为 Set 使用的默认过期时间，0 表示永不过期
+func NewTyped(client Client, codec Codec, expiration time.Duration) *Typed {
+	return &Typed{
+		client:     client,
+		codec:      codec,
+		expiration: expiration,
+	}
+}
+
+// 获得缓存并解码至 v，v 必须为指针，缓存不存在则 found 为 false 且 v 不会被修改
+func (t *Typed) Get(ctx context.Context, key string, v interface{}) (found bool, err error) {
+	data, err := t.client.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	return t.decode(data, v)
+}
+
+// 批量获得缓存，target 返回第 i 个 key 对应的解码目标(指针)，found 与 keys 一一对应
+func (t *Typed) MGet(ctx context.Context, keys []string, target func(i int) interface{}) (found []bool, err error) {
+	values, err := t.client.MGet(ctx, keys...)
+	if err != nil {
+		return nil, err
+	}
+	found = make([]bool, len(keys))
+	for i, data := range values {
+		if valueEntry(data) {
+			found[i], err = t.decode(data, target(i))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return found, nil
+}
+
+// 使用默认过期时间设置缓存
+func (t *Typed) Set(ctx context.Context, key string, v interface{}) error {
+	return t.SetWithTTL(ctx, key, v, t.expiration)
+}
+
+// 使用指定的过期时间设置缓存
+func (t *Typed) SetWithTTL(ctx context.Context, key string, v interface{}, expiration time.Duration) error {
+	data, err := t.encode(v)
+	if err != nil {
+		return err
+	}
+	return t.client.Set(ctx, key, data, expiration)
+}
+
+// 设置负缓存，表示数据源中不存在该数据，Get 将其视为缓存不存在，Loader 则不会再次加载该数据
+func (t *Typed) SetNotFound(ctx context.Context, key string, expiration time.Duration) error {
+	return t.client.Set(ctx, key, notFoundMarker, expiration)
+}
+
+// 删除缓存
+func (t *Typed) Delete(ctx context.Context, keys ...string) error {
+	return t.client.Delete(ctx, keys...)
+}
+
+// 编码 v 并添加数据标记
+func (t *Typed) encode(v interface{}) ([]byte, error) {
+	data, err := t.codec.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte{valueFlag}, data...), nil
+}
+
+// 解码缓存数据至 v，负缓存及没有数据标记的数据(如旧版本写入的数据)视为缓存不存在
+func (t *Typed) decode(data []byte, v interface{}) (found bool, err error) {
+	if !valueEntry(data) {
+		return false, nil
+	}
+	err = t.codec.Unmarshal(data[1:], v)
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// 是否为带有数据标记的数据
+func valueEntry(data []byte) bool {
+	return len(data) > 0 && data[0] == valueFlag
+}
+
+// 是否为负缓存
+func notFoundEntry(data []byte) bool {
+	return len(data) == 1 && data[0] == notFoundFlag
+}
@@ -0,0 +1,97 @@
+package cache_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/x_time"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type profile struct {
+	ID       int
+	Username string
+	Tags     []string
+}
+
+func TestTyped(t *testing.T) {
+	ctx := context.Background()
+	codecs := map[string]cache.Codec{
+		"json":    cache.JSON,
+		"gob":     cache.Gob,
+		"msgpack": cache.Msgpack,
+	}
+	for name, codec := range codecs {
+		clock := x_time.NewFake(time.Now())
+		client := cache.NewMemoryClient(cache.MemoryConfig{Clock: clock})
+		defer client.Stop()
+		typed := cache.NewTyped(client, codec, time.Hour)
+		need := profile{ID: 1, Username: "user_01", Tags: []string{"a", "b"}}
+		err := typed.Set(ctx, "profile_1", need)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = typed.SetWithTTL(ctx, "profile_2", need, time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(2 * time.Minute)
+		got := profile{}
+		found, err := typed.Get(ctx, "profile_1", &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !found || !reflect.DeepEqual(got, need) {
+			t.Errorf("%s need: %v, got: %v, %t\n", name, need, got, found)
+		}
+		found, err = typed.Get(ctx, "profile_2", &got)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if found {
+			t.Errorf("%s profile_2 need: not found\n", name)
+		}
+	}
+}
+
+func TestRawCodec(t *testing.T) {
+	ctx := context.Background()
+	client := cache.NewMemoryClient(cache.MemoryConfig{})
+	defer client.Stop()
+	typed := cache.NewTyped(client, cache.Raw, 0)
+	_ = typed.Set(ctx, "bytes", []byte("bytes"))
+	_ = typed.Set(ctx, "string", "string")
+	_ = typed.Set(ctx, "empty", "")
+	var bs []byte
+	var s, empty string
+	found, err := typed.MGet(ctx, []string{"bytes", "string", "empty", "not_exist"}, func(i int) interface{} {
+		return []interface{}{&bs, &s, &empty, nil}[i]
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if need := []bool{true, true, true, false}; !reflect.DeepEqual(found, need) {
+		t.Errorf("need: %v, got: %v\n", need, found)
+	}
+	if string(bs) != "bytes" || s != "string" {
+		t.Errorf("need: bytes, string, got: %s, %s\n", bs, s)
+	}
+	if err = typed.Set(ctx, "int", 1); err != cache.ErrUnsupportedType {
+		t.Errorf("need: %v, got: %v\n", cache.ErrUnsupportedType, err)
+	}
+	// 任意字节都不会与负缓存标记冲突
+	for _, value := range []string{"\x00", "\x01", "\x00cache:not_found"} {
+		_ = typed.Set(ctx, "bytes", value)
+		var got string
+		ok, err := typed.Get(ctx, "bytes", &got)
+		if err != nil || !ok || got != value {
+			t.Errorf("%q need: found, got: %q, %t, %v\n", value, got, ok, err)
+		}
+	}
+	// 没有数据标记的数据视为缓存不存在
+	_ = client.Set(ctx, "unmarked", []byte("unmarked"), 0)
+	if ok, err := typed.Get(ctx, "unmarked", &s); err != nil || ok {
+		t.Errorf("unmarked need: not found, got: %t, %v\n", ok, err)
+	}
+}
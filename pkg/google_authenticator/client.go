@@ -1,50 +1,191 @@
 package google_authenticator
 
 import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
 	"encoding/base32"
-	"github.com/dgryski/dgoogauth"
+	"encoding/hex"
+	"errors"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/x_time"
 	"net/url"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// 验证码格式错误，即位数与配置不符或包含非数字字符
+var ErrInvalidCode = errors.New("google_authenticator: invalid code")
+
 type QRCodeURIGetter func(QRCodeContent string, with, height int) string
 
 type Client struct {
 	config Config
+	skew   uint64
 }
 
 type Config struct {
-	QRCodeURIGetter QRCodeURIGetter // 二维码图片及地址生成器，不传该参数则默认通过 https://api.qrserver.com 生成二维码图片地址
-	ValidRange      int             // 验证区间，即前面 n 个验证码算作有效验证码，取值范围 0-100，最好不要超过 3
+	QRCodeURIGetter QRCodeURIGetter // 二维码图片及地址生成器，不传该参数则默认在本地生成 PNG 图片的 data: URI
+	ValidRange      int             // 验证区间，即前后共 n 个验证码算作有效验证码，取值范围 0-100，最好不要超过 3，Skew 不为 0 时忽略该参数
+	Skew            int             // 允许的时间偏差周期数，当前周期前后各 Skew 个周期的验证码均有效
+	Digits          int             // 验证码位数，取值范围 6-8，默认 6
+	Period          time.Duration   // 验证码更新周期，需为整秒，默认 30 秒
+	Algorithm       Algorithm       // 哈希算法，默认 SHA1，谷歌验证器仅支持 SHA1
+	Clock           x_time.Clock    // 时钟，用于计算当前时间的验证码，为空则使用系统时间
+	Cache           cache.Client    // 记录每个密钥通过验证的周期，用于防止验证码重放，为空则不防重放，多节点部署时需使用共享缓存
+	Issuer          string          // 发行方，即验证器中显示的品牌名称，不能包含冒号，为空则不显示
+	AccountLabel    string          // 账户名模板，{user} 替换为用户名，如 "{user}@example.com"，默认 "{user}"
+	Image           string          // 验证器中显示的图标地址，部分验证器(如 FreeOTP)支持，为空则不设置
 }
 
+// 配置错误(位数、周期或算法不支持)时 panic
 func NewClient(c Config) *Client {
 	if c.QRCodeURIGetter == nil {
-		// 使用第三方二维码生成器
-		c.QRCodeURIGetter = func(content string, with, height int) string {
-			return "https://api.qrserver.com/v1/create-qr-code/?data=" +
-				url.QueryEscape(content) +
-				"&size=" + strconv.Itoa(with) + "x" + strconv.Itoa(height) + "&ecc=M"
-		}
+		// 二维码内容包含密钥，不能发送到第三方服务
+		c.QRCodeURIGetter = LocalQRCodeURIGetter(PNG)
+	}
+	if c.Digits == 0 {
+		c.Digits = 6
+	}
+	if c.Period == 0 {
+		c.Period = 30 * time.Second
+	}
+	if c.Algorithm == "" {
+		c.Algorithm = SHA1
+	}
+	if c.AccountLabel == "" {
+		c.AccountLabel = "{user}"
+	}
+	if strings.Contains(c.Issuer, ":") {
+		panic("google_authenticator: issuer must not contain colon, got " + c.Issuer)
+	}
+	if c.Digits < 6 || c.Digits > 8 {
+		panic("google_authenticator: digits must be in [6, 8], got " + strconv.Itoa(c.Digits))
+	}
+	if c.Period < time.Second || c.Period%time.Second != 0 {
+		panic("google_authenticator: period must be a positive number of seconds, got " + c.Period.String())
+	}
+	if c.Algorithm.hash() == nil {
+		panic("google_authenticator: unsupported algorithm " + string(c.Algorithm))
 	}
+	skew := c.Skew
+	if skew == 0 {
+		skew = c.ValidRange / 2
+	}
+	if skew < 0 {
+		skew = 0
+	}
+	c.Clock = x_time.Or(c.Clock)
 	return &Client{
 		config: c,
+		skew:   uint64(skew),
 	}
 }
 
 // 获得二维码内容
 func (c *Client) GetQRCodeURI(secret, user string, with, height int) string {
-	cfg := &dgoogauth.OTPConfig{
-		Secret: base32.StdEncoding.EncodeToString([]byte(secret)),
+	return c.config.QRCodeURIGetter(c.ProvisionURI(secret, user), with, height)
+}
+
+// 在本地生成二维码图片，size 为图片边长(像素)，不受 QRCodeURIGetter 影响
+func (c *Client) QRCode(secret, user string, format ImageFormat, size int) ([]byte, error) {
+	return renderQRCode(c.ProvisionURI(secret, user), format, size)
+}
+
+// 获得 otpauth:// 格式的密钥地址，即二维码内容，格式见 https://github.com/google/google-authenticator/wiki/Key-Uri-Format，
+// 默认配置的参数不写入地址以兼容只支持默认配置的验证器
+func (c *Client) ProvisionURI(secret, user string) string {
+	query := url.Values{}
+	query.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte(secret)))
+	// 账户名中的冒号需要转义，以免与发行方前缀混淆
+	label := strings.Replace(url.PathEscape(strings.Replace(c.config.AccountLabel, "{user}", user, -1)), ":", "%3A", -1)
+	if c.config.Issuer != "" {
+		// 标签前缀及 issuer 参数同时设置，兼容只识别其中之一的验证器
+		label = url.PathEscape(c.config.Issuer) + ":" + label
+		query.Set("issuer", c.config.Issuer)
+	}
+	if c.config.Algorithm != SHA1 {
+		query.Set("algorithm", string(c.config.Algorithm))
+	}
+	if c.config.Digits != 6 {
+		query.Set("digits", strconv.Itoa(c.config.Digits))
+	}
+	if c.config.Period != 30*time.Second {
+		query.Set("period", strconv.Itoa(int(c.config.Period/time.Second)))
 	}
-	return c.config.QRCodeURIGetter(cfg.ProvisionURI(user), with, height)
+	if c.config.Image != "" {
+		query.Set("image", c.config.Image)
+	}
+	// 规范要求空格编码为 %20，部分验证器会将 + 原样显示
+	return "otpauth://totp/" + label + "?" + strings.Replace(query.Encode(), "+", "%20", -1)
+}
+
+// 获得当前时间的验证码
+func (c *Client) Code(secret string) string {
+	return TOTP([]byte(secret), c.config.Clock.Now(), c.config.Period, c.config.Digits, c.config.Algorithm)
 }
 
-// 验证
+// 验证，当前周期前后 Skew 个周期内的验证码均有效，验证码格式错误时返回 ErrInvalidCode。
+// 配置了 Cache 时，每个验证码只能通过一次验证，且不早于该密钥最后通过验证的周期
 func (c *Client) Verify(secret, code string) (bool, error) {
-	cfg := &dgoogauth.OTPConfig{
-		Secret:     base32.StdEncoding.EncodeToString([]byte(secret)),
-		WindowSize: c.config.ValidRange,
+	return c.VerifyContext(context.Background(), secret, code)
+}
+
+// 与 Verify 相同，ctx 用于缓存操作
+func (c *Client) VerifyContext(ctx context.Context, secret, code string) (bool, error) {
+	counter, ok, err := c.verify(secret, code)
+	if err != nil || !ok || c.config.Cache == nil {
+		return ok, err
+	}
+	return c.accept(ctx, secret, counter)
+}
+
+// 记录通过验证的周期。每个周期通过 SetNX 原子地占用，同一周期并发验证时只有一个请求占用成功，
+// 占用后如果该密钥更晚的周期已被占用则返回 false，因此通过验证的周期严格递增
+func (c *Client) accept(ctx context.Context, secret string, counter uint64) (bool, error) {
+	sum := sha256.Sum256([]byte(secret))
+	// 不在缓存中保存密钥明文，hash tag 保证集群模式下同一密钥的周期位于同一个 slot，以便 MGet
+	prefix := "{totp_" + hex.EncodeToString(sum[:]) + "}_"
+	// 超过该时间后，该周期已不在验证区间内，无需继续保存
+	expiration := time.Duration(2*c.skew+1) * c.config.Period
+	ok, err := c.config.Cache.SetNX(ctx, prefix+strconv.FormatUint(counter, 10), []byte("1"), expiration)
+	if err != nil || !ok {
+		return false, err
+	}
+	// 该周期在验证区间内时，可能通过验证的更晚周期不超过 counter+2*skew。
+	// 更晚的周期先于本次占用则拒绝本次验证，晚于本次占用则两者按占用顺序递增，均可通过
+	keys := make([]string, 2*c.skew)
+	for i := range keys {
+		keys[i] = prefix + strconv.FormatUint(counter+uint64(i)+1, 10)
+	}
+	values, err := c.config.Cache.MGet(ctx, keys...)
+	if err != nil {
+		return false, err
+	}
+	for _, value := range values {
+		if value != nil {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// 验证并返回匹配的周期
+func (c *Client) verify(secret, code string) (counter uint64, ok bool, err error) {
+	if len(code) != c.config.Digits || strings.Trim(code, "0123456789") != "" {
+		return 0, false, ErrInvalidCode
+	}
+	now := counterAt(c.config.Clock.Now(), c.config.Period)
+	min := uint64(0)
+	if now > c.skew {
+		min = now - c.skew
+	}
+	for counter = min; counter <= now+c.skew; counter++ {
+		expected := HOTP([]byte(secret), counter, c.config.Digits, c.config.Algorithm)
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return counter, true, nil
+		}
 	}
-	return cfg.Authenticate(code)
+	return 0, false, nil
 }
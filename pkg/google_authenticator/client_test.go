@@ -0,0 +1,148 @@
+package google_authenticator_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/google_authenticator"
+	"github.com/morgine/moon/pkg/x_time"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClient_Verify(t *testing.T) {
+	// RFC 6238 附录 B 的 SHA1 测试数据，取后 6 位
+	secret := "12345678901234567890"
+	clock := x_time.NewFake(time.Unix(59, 0))
+	client := google_authenticator.NewClient(google_authenticator.Config{ValidRange: 2, Clock: clock})
+	ok, err := client.Verify(secret, "287082")
+	if err != nil || !ok {
+		t.Errorf("need: true, got: %t, %v\n", ok, err)
+	}
+	// 下一个周期仍在验证区间内
+	clock.Advance(30 * time.Second)
+	if ok, _ = client.Verify(secret, "287082"); !ok {
+		t.Error("need: true in valid range, got: false")
+	}
+	clock.Advance(30 * time.Second)
+	if ok, _ = client.Verify(secret, "287082"); ok {
+		t.Error("need: false out of valid range, got: true")
+	}
+	clock.Set(time.Unix(1111111109, 0))
+	if ok, _ = client.Verify(secret, "081804"); !ok {
+		t.Error("need: true, got: false")
+	}
+	for _, code := range []string{"12345", "-12345", "abcdef"} {
+		if _, err = client.Verify(secret, code); err == nil {
+			t.Errorf("%s need error, got: nil\n", code)
+		}
+	}
+}
+
+func TestClient_Config(t *testing.T) {
+	secret := "12345678901234567890123456789012"
+	clock := x_time.NewFake(time.Unix(1111111109, 0))
+	client := google_authenticator.NewClient(google_authenticator.Config{
+		Digits:    8,
+		Period:    60 * time.Second,
+		Algorithm: google_authenticator.SHA256,
+		Skew:      1,
+		Clock:     clock,
+	})
+	code := google_authenticator.TOTP([]byte(secret), clock.Now(), time.Minute, 8, google_authenticator.SHA256)
+	if got := client.Code(secret); got != code {
+		t.Errorf("need: %s, got: %s\n", code, got)
+	}
+	clock.Advance(time.Minute)
+	if ok, err := client.Verify(secret, code); err != nil || !ok {
+		t.Errorf("need: true, got: %t, %v\n", ok, err)
+	}
+	if _, err := client.Verify(secret, code[:6]); err != google_authenticator.ErrInvalidCode {
+		t.Errorf("need: %v, got: %v\n", google_authenticator.ErrInvalidCode, err)
+	}
+	need := "otpauth://totp/user%2001?algorithm=SHA256&digits=8&period=60&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA"
+	if got := client.ProvisionURI(secret, "user 01"); got != need {
+		t.Errorf("need: %s, got: %s\n", need, got)
+	}
+}
+
+func TestClient_Replay(t *testing.T) {
+	ctx := context.Background()
+	secret := "12345678901234567890"
+	clock := x_time.NewFake(time.Unix(59, 0))
+	client := google_authenticator.NewClient(google_authenticator.Config{
+		Skew:  1,
+		Clock: clock,
+		Cache: cache.NewMemoryClient(cache.MemoryConfig{Clock: clock}),
+	})
+	code := client.Code(secret)
+	if ok, err := client.Verify(secret, code); err != nil || !ok {
+		t.Fatalf("need: true, got: %t, %v\n", ok, err)
+	}
+	// 同一验证码不能再次使用
+	if ok, _ := client.Verify(secret, code); ok {
+		t.Error("need: false for reused code, got: true")
+	}
+	// 同一验证码并发验证时只有一个请求通过
+	concurrent := "11111111112222222222"
+	code = client.Code(concurrent)
+	var accepted int
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := client.VerifyContext(ctx, concurrent, code); ok {
+				mu.Lock()
+				accepted++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if accepted != 1 {
+		t.Errorf("need: 1 accepted concurrent verification, got: %d\n", accepted)
+	}
+	// 其他密钥不受影响
+	other := "09876543210987654321"
+	if ok, _ := client.Verify(other, client.Code(other)); !ok {
+		t.Error("need: true for other secret, got: false")
+	}
+	// 使用下一个周期的验证码后，上一个周期的验证码即使未使用过也无效
+	clock.Advance(30 * time.Second)
+	previous := google_authenticator.TOTP([]byte(secret), clock.Now().Add(-30*time.Second), 30*time.Second, 6, google_authenticator.SHA1)
+	next := google_authenticator.TOTP([]byte(secret), clock.Now().Add(30*time.Second), 30*time.Second, 6, google_authenticator.SHA1)
+	if ok, _ := client.Verify(secret, next); !ok {
+		t.Error("need: true, got: false")
+	}
+	if ok, _ := client.Verify(secret, client.Code(secret)); ok {
+		t.Error("need: false for code before last accepted, got: true")
+	}
+	if ok, _ := client.Verify(secret, previous); ok {
+		t.Error("need: false for code before last accepted, got: true")
+	}
+	// 验证区间过后新的验证码正常通过
+	clock.Advance(2 * time.Minute)
+	if ok, _ := client.Verify(secret, client.Code(secret)); !ok {
+		t.Error("need: true, got: false")
+	}
+}
+
+func TestClient_ProvisionURI(t *testing.T) {
+	client := google_authenticator.NewClient(google_authenticator.Config{
+		Issuer:       "Moon Inc",
+		AccountLabel: "{user}@moon.com",
+		Image:        "https://moon.com/logo.png",
+	})
+	need := "otpauth://totp/Moon%20Inc:a%3Ab%20c@moon.com?image=https%3A%2F%2Fmoon.com%2Flogo.png&issuer=Moon%20Inc&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if got := client.ProvisionURI("12345678901234567890", "a:b c"); got != need {
+		t.Errorf("need: %s, got: %s\n", need, got)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("need panic for issuer with colon")
+		}
+	}()
+	google_authenticator.NewClient(google_authenticator.Config{Issuer: "Moon:Inc"})
+}
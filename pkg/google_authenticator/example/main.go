@@ -14,16 +14,28 @@ func main() {
 	client := google_authenticator.NewClient(google_authenticator.Config{
 		QRCodeURIGetter: nil,
 		ValidRange:      0,
+		Issuer:          "Example", // 验证器中显示的品牌名称
 	})
 	// 获得二维码
 	http.HandleFunc("/qrcode", func(writer http.ResponseWriter, request *http.Request) {
 		user := request.URL.Query().Get("user")
 		_, _ = writer.Write([]byte(client.GetQRCodeURI(userSecret, user, 200, 200)))
 	})
+	// 直接输出二维码图片
+	http.HandleFunc("/qrcode.png", func(writer http.ResponseWriter, request *http.Request) {
+		user := request.URL.Query().Get("user")
+		img, err := client.QRCode(userSecret, user, google_authenticator.PNG, 200)
+		if err != nil {
+			http.Error(writer, err.Error(), http.StatusInternalServerError)
+		} else {
+			writer.Header().Set("Content-Type", google_authenticator.PNG.ContentType())
+			_, _ = writer.Write(img)
+		}
+	})
 	// 验证 code
 	http.HandleFunc("/check", func(writer http.ResponseWriter, request *http.Request) {
 		code := request.URL.Query().Get("code")
-		ok, err := client.Verify(userSecret, code)
+		ok, err := client.VerifyContext(request.Context(), userSecret, code)
 		if err != nil {
 			http.Error(writer, err.Error(), http.StatusInternalServerError)
 		} else {
@@ -0,0 +1,148 @@
+package google_authenticator
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"strconv"
+)
+
+// 二维码图片格式
+type ImageFormat string
+
+const (
+	PNG ImageFormat = "png"
+	SVG ImageFormat = "svg"
+)
+
+var ErrUnsupportedImageFormat = errors.New("google_authenticator: unsupported image format")
+
+const (
+	quietZone        = 4    // 二维码四周留白的模块数
+	defaultImageSize = 200  // 未指定尺寸时的图片边长(像素)
+	maxImageSize     = 2048 // 图片最大边长(像素)，避免请求方指定过大的尺寸
+)
+
+// 图片的 MIME 类型
+func (f ImageFormat) ContentType() string {
+	switch f {
+	case PNG:
+		return "image/png"
+	case SVG:
+		return "image/svg+xml"
+	default:
+		return ""
+	}
+}
+
+// 生成指定格式的图片，size 为图片边长(像素)，为 0 时使用默认尺寸 200，超出 2048 时使用 2048
+func (q *QRCode) Image(format ImageFormat, size int) ([]byte, error) {
+	switch format {
+	case PNG:
+		return q.PNG(size)
+	case SVG:
+		return q.SVG(size), nil
+	default:
+		return nil, ErrUnsupportedImageFormat
+	}
+}
+
+// 生成 PNG 图片，每个模块占整数个像素，因此实际边长可能略小于 size，但不小于每模块 1 像素
+func (q *QRCode) PNG(size int) ([]byte, error) {
+	modules := q.Size + quietZone*2
+	scale := imageSize(size) / modules
+	if scale < 1 {
+		scale = 1
+	}
+	palette := color.Palette{color.White, color.Black}
+	img := image.NewPaletted(image.Rect(0, 0, modules*scale, modules*scale), palette)
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if !q.modules[y][x] {
+				continue
+			}
+			px, py := (x+quietZone)*scale, (y+quietZone)*scale
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex(px+dx, py+dy, 1)
+				}
+			}
+		}
+	}
+	buf := &bytes.Buffer{}
+	err := png.Encode(buf, img)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// 生成 SVG 图片，矢量图形可任意缩放，size 仅作为默认显示尺寸
+func (q *QRCode) SVG(size int) []byte {
+	modules := strconv.Itoa(q.Size + quietZone*2)
+	pixels := strconv.Itoa(imageSize(size))
+	buf := &bytes.Buffer{}
+	buf.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" version="1.1" width="` + pixels + `" height="` + pixels +
+		`" viewBox="0 0 ` + modules + ` ` + modules + `" shape-rendering="crispEdges">`)
+	buf.WriteString(`<rect width="100%" height="100%" fill="#FFFFFF"/><path fill="#000000" d="`)
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			if q.modules[y][x] {
+				buf.WriteString("M" + strconv.Itoa(x+quietZone) + "," + strconv.Itoa(y+quietZone) + "h1v1h-1z")
+			}
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
+
+// 生成 data: URI，可直接用作 <img> 的 src
+func DataURI(contentType string, data []byte) string {
+	return "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+}
+
+// 本地二维码生成器，返回 data: URI，二维码内容不会发送到第三方服务，图片边长取 with 与 height 中较小的值
+func LocalQRCodeURIGetter(format ImageFormat) QRCodeURIGetter {
+	if format.ContentType() == "" {
+		panic(ErrUnsupportedImageFormat)
+	}
+	return func(content string, with, height int) string {
+		data, err := renderQRCode(content, format, squareSize(with, height))
+		if err != nil {
+			// 仅当内容超出二维码容量时出错，otpauth 地址不会超出
+			return ""
+		}
+		return DataURI(format.ContentType(), data)
+	}
+}
+
+func renderQRCode(content string, format ImageFormat, size int) ([]byte, error) {
+	q, err := EncodeQRCode([]byte(content), QRLevelM)
+	if err != nil {
+		return nil, err
+	}
+	return q.Image(format, size)
+}
+
+func imageSize(size int) int {
+	if size <= 0 {
+		return defaultImageSize
+	}
+	if size > maxImageSize {
+		return maxImageSize
+	}
+	return size
+}
+
+func squareSize(with, height int) int {
+	if with <= 0 {
+		return height
+	}
+	if height > 0 && height < with {
+		return height
+	}
+	return with
+}
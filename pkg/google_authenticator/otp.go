@@ -0,0 +1,67 @@
+package google_authenticator
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"hash"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 验证码哈希算法
+type Algorithm string
+
+const (
+	SHA1   Algorithm = "SHA1" // 默认算法，谷歌验证器仅支持该算法
+	SHA256 Algorithm = "SHA256"
+	SHA512 Algorithm = "SHA512"
+)
+
+func (a Algorithm) hash() func() hash.Hash {
+	switch a {
+	case SHA1:
+		return sha1.New
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	default:
+		return nil
+	}
+}
+
+// 根据 RFC 4226 计算计数器 counter 对应的 digits 位验证码
+func HOTP(key []byte, counter uint64, digits int, algorithm Algorithm) string {
+	mac := hmac.New(algorithm.hash(), key)
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	// 动态截取
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	code := strconv.FormatUint(uint64(value%pow10(digits)), 10)
+	return strings.Repeat("0", digits-len(code)) + code
+}
+
+// 根据 RFC 6238 计算时间 t 对应的 digits 位验证码
+func TOTP(key []byte, t time.Time, period time.Duration, digits int, algorithm Algorithm) string {
+	return HOTP(key, counterAt(t, period), digits, algorithm)
+}
+
+// 时间 t 所在的周期
+func counterAt(t time.Time, period time.Duration) uint64 {
+	return uint64(t.Unix() / int64(period/time.Second))
+}
+
+func pow10(n int) uint32 {
+	p := uint32(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
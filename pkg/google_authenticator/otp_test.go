@@ -0,0 +1,47 @@
+package google_authenticator_test
+
+import (
+	"github.com/morgine/moon/pkg/google_authenticator"
+	"testing"
+	"time"
+)
+
+// RFC 4226 附录 D
+func TestHOTP(t *testing.T) {
+	key := []byte("12345678901234567890")
+	codes := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, need := range codes {
+		if got := google_authenticator.HOTP(key, uint64(counter), 6, google_authenticator.SHA1); got != need {
+			t.Errorf("%d need: %s, got: %s\n", counter, need, got)
+		}
+	}
+}
+
+// RFC 6238 附录 B，SHA256 及 SHA512 的密钥分别为 32 及 64 字节
+func TestTOTP(t *testing.T) {
+	keys := map[google_authenticator.Algorithm][]byte{
+		google_authenticator.SHA1:   []byte("12345678901234567890"),
+		google_authenticator.SHA256: []byte("12345678901234567890123456789012"),
+		google_authenticator.SHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+	}
+	type testcase struct {
+		unix  int64
+		codes map[google_authenticator.Algorithm]string
+	}
+	testcases := []testcase{
+		{59, map[google_authenticator.Algorithm]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[google_authenticator.Algorithm]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1111111111, map[google_authenticator.Algorithm]string{"SHA1": "14050471", "SHA256": "67062674", "SHA512": "99943326"}},
+		{1234567890, map[google_authenticator.Algorithm]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{2000000000, map[google_authenticator.Algorithm]string{"SHA1": "69279037", "SHA256": "90698825", "SHA512": "38618901"}},
+		{20000000000, map[google_authenticator.Algorithm]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+	for _, tc := range testcases {
+		for algorithm, need := range tc.codes {
+			got := google_authenticator.TOTP(keys[algorithm], time.Unix(tc.unix, 0), 30*time.Second, 8, algorithm)
+			if got != need {
+				t.Errorf("%s %d need: %s, got: %s\n", algorithm, tc.unix, need, got)
+			}
+		}
+	}
+}
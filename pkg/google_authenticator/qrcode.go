@@ -0,0 +1,503 @@
+package google_authenticator
+
+import (
+	"errors"
+)
+
+// 二维码纠错等级
+type QRLevel int
+
+const (
+	QRLevelL QRLevel = iota // 可恢复约 7% 的数据
+	QRLevelM                // 可恢复约 15% 的数据
+	QRLevelQ                // 可恢复约 25% 的数据
+	QRLevelH                // 可恢复约 30% 的数据
+)
+
+var ErrQRCodeTooLong = errors.New("google_authenticator: qr code content too long")
+
+// 各纠错等级在格式信息中的编码
+var qrLevelFormatBits = [4]int{1, 0, 3, 2}
+
+// 各版本每块纠错码字数，下标为 [纠错等级][版本]
+var qrECCCodewordsPerBlock = [4][41]int{
+	{-1, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+	{-1, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	{-1, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+}
+
+// 各版本纠错块数，下标为 [纠错等级][版本]
+var qrECCBlocks = [4][41]int{
+	{-1, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+	{-1, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+	{-1, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+	{-1, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+}
+
+// 二维码矩阵，使用字节模式编码，自动选择最小版本及惩罚分最低的掩码
+type QRCode struct {
+	Size     int // 每边模块数
+	version  int
+	level    QRLevel
+	modules  [][]bool // true 表示深色模块，下标为 [y][x]
+	function [][]bool // 功能图形(定位、校正、时序及格式信息)，不参与数据填充及掩码
+}
+
+// 将 content 编码为二维码，内容超过版本 40 的容量时返回 ErrQRCodeTooLong
+func EncodeQRCode(content []byte, level QRLevel) (*QRCode, error) {
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if qrDataBits(v, len(content)) <= qrDataCodewords(v, level)*8 {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrQRCodeTooLong
+	}
+	// 字节模式，模式指示符 0100
+	bits := &bitBuffer{}
+	bits.append(4, 4)
+	bits.append(len(content), qrCountBits(version))
+	for _, b := range content {
+		bits.append(int(b), 8)
+	}
+	capacity := qrDataCodewords(version, level) * 8
+	// 终止符及字节对齐
+	terminator := capacity - bits.len()
+	if terminator > 4 {
+		terminator = 4
+	}
+	bits.append(0, terminator)
+	bits.append(0, (8-bits.len()%8)%8)
+	for pad := 0xEC; bits.len() < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	size := version*4 + 17
+	q := &QRCode{Size: size, version: version, level: level}
+	q.modules = make([][]bool, size)
+	q.function = make([][]bool, size)
+	for i := range q.modules {
+		q.modules[i] = make([]bool, size)
+		q.function[i] = make([]bool, size)
+	}
+	q.drawFunctionPatterns()
+	q.drawCodewords(q.addECCAndInterleave(bits.bytes()))
+
+	best, minPenalty := 0, -1
+	for mask := 0; mask < 8; mask++ {
+		q.applyMask(mask)
+		q.drawFormatBits(mask)
+		penalty := q.penalty()
+		if minPenalty < 0 || penalty < minPenalty {
+			best, minPenalty = mask, penalty
+		}
+		// 再次应用掩码即可还原
+		q.applyMask(mask)
+	}
+	q.applyMask(best)
+	q.drawFormatBits(best)
+	return q, nil
+}
+
+// 模块是否为深色，坐标超出范围时为浅色
+func (q *QRCode) Black(x, y int) bool {
+	return x >= 0 && x < q.Size && y >= 0 && y < q.Size && q.modules[y][x]
+}
+
+func (q *QRCode) set(x, y int, black bool) {
+	q.modules[y][x] = black
+	q.function[y][x] = true
+}
+
+func (q *QRCode) drawFunctionPatterns() {
+	// 时序图形
+	for i := 0; i < q.Size; i++ {
+		q.set(6, i, i%2 == 0)
+		q.set(i, 6, i%2 == 0)
+	}
+	// 定位图形
+	q.drawFinderPattern(3, 3)
+	q.drawFinderPattern(q.Size-4, 3)
+	q.drawFinderPattern(3, q.Size-4)
+	// 校正图形，与定位图形重叠的位置除外
+	positions := q.alignmentPositions()
+	n := len(positions)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if (i == 0 && j == 0) || (i == 0 && j == n-1) || (i == n-1 && j == 0) {
+				continue
+			}
+			q.drawAlignmentPattern(positions[i], positions[j])
+		}
+	}
+	// 先占位格式信息，选择掩码后再写入
+	q.drawFormatBits(0)
+	q.drawVersion()
+}
+
+func (q *QRCode) drawFinderPattern(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx >= 0 && xx < q.Size && yy >= 0 && yy < q.Size {
+				dist := max(abs(dx), abs(dy))
+				q.set(xx, yy, dist != 2 && dist != 4)
+			}
+		}
+	}
+}
+
+func (q *QRCode) drawAlignmentPattern(x, y int) {
+	for dy := -2; dy <= 2; dy++ {
+		for dx := -2; dx <= 2; dx++ {
+			q.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+		}
+	}
+}
+
+// 校正图形中心坐标
+func (q *QRCode) alignmentPositions() []int {
+	if q.version == 1 {
+		return nil
+	}
+	n := q.version/7 + 2
+	step := (q.version*8 + n*3 + 5) / (n*4 - 4) * 2
+	positions := make([]int, n)
+	positions[0] = 6
+	for i, pos := n-1, q.Size-7; i >= 1; i, pos = i-1, pos-step {
+		positions[i] = pos
+	}
+	return positions
+}
+
+// 写入纠错等级及掩码，BCH(15,5) 编码
+func (q *QRCode) drawFormatBits(mask int) {
+	data := qrLevelFormatBits[q.level]<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = (rem << 1) ^ ((rem >> 9) * 0x537)
+	}
+	bits := (data<<10 | rem) ^ 0x5412
+	// 左上角
+	for i := 0; i <= 5; i++ {
+		q.set(8, i, bit(bits, i))
+	}
+	q.set(8, 7, bit(bits, 6))
+	q.set(8, 8, bit(bits, 7))
+	q.set(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		q.set(14-i, 8, bit(bits, i))
+	}
+	// 右上角及左下角
+	for i := 0; i < 8; i++ {
+		q.set(q.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		q.set(8, q.Size-15+i, bit(bits, i))
+	}
+	q.set(8, q.Size-8, true)
+}
+
+// 版本 7 及以上写入版本信息，BCH(18,6) 编码
+func (q *QRCode) drawVersion() {
+	if q.version < 7 {
+		return
+	}
+	rem := q.version
+	for i := 0; i < 12; i++ {
+		rem = (rem << 1) ^ ((rem >> 11) * 0x1F25)
+	}
+	bits := q.version<<12 | rem
+	for i := 0; i < 18; i++ {
+		a, b := q.Size-11+i%3, i/3
+		q.set(a, b, bit(bits, i))
+		q.set(b, a, bit(bits, i))
+	}
+}
+
+// 数据分块并计算纠错码，然后按列交织
+func (q *QRCode) addECCAndInterleave(data []byte) []byte {
+	numBlocks := qrECCBlocks[q.level][q.version]
+	eccLen := qrECCCodewordsPerBlock[q.level][q.version]
+	raw := qrRawDataModules(q.version) / 8
+	numShortBlocks := numBlocks - raw%numBlocks
+	shortBlockLen := raw / numBlocks
+	divisor := rsDivisor(eccLen)
+	blocks := make([][]byte, numBlocks)
+	k := 0
+	for i := range blocks {
+		n := shortBlockLen - eccLen
+		if i >= numShortBlocks {
+			n++
+		}
+		block := append([]byte{}, data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		// 短块补齐一个占位字节，交织时跳过
+		if i < numShortBlocks {
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+	result := make([]byte, 0, raw)
+	for i := range blocks[0] {
+		for j, block := range blocks {
+			if i != shortBlockLen-eccLen || j >= numShortBlocks {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// 按之字形从右下角开始填充数据，跳过功能图形
+func (q *QRCode) drawCodewords(data []byte) {
+	i := 0
+	for right := q.Size - 1; right >= 1; right -= 2 {
+		// 跳过垂直时序图形所在列
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < q.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					y = q.Size - 1 - vert
+				}
+				if !q.function[y][x] && i < len(data)*8 {
+					q.modules[y][x] = bit(int(data[i>>3]), 7-i&7)
+					i++
+				}
+			}
+		}
+	}
+}
+
+func (q *QRCode) applyMask(mask int) {
+	for y := 0; y < q.Size; y++ {
+		for x := 0; x < q.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !q.function[y][x] {
+				q.modules[y][x] = !q.modules[y][x]
+			}
+		}
+	}
+}
+
+// 按 ISO/IEC 18004 计算掩码惩罚分
+func (q *QRCode) penalty() int {
+	penalty := 0
+	dark := 0
+	for i := 0; i < q.Size; i++ {
+		row := make([]bool, q.Size)
+		col := make([]bool, q.Size)
+		for j := 0; j < q.Size; j++ {
+			row[j], col[j] = q.modules[i][j], q.modules[j][i]
+			if row[j] {
+				dark++
+			}
+		}
+		penalty += linePenalty(row) + linePenalty(col)
+	}
+	// 2x2 同色块
+	for y := 0; y < q.Size-1; y++ {
+		for x := 0; x < q.Size-1; x++ {
+			c := q.modules[y][x]
+			if c == q.modules[y][x+1] && c == q.modules[y+1][x] && c == q.modules[y+1][x+1] {
+				penalty += 3
+			}
+		}
+	}
+	// 深色模块比例偏离 50%，每 5% 计 10 分
+	total := q.Size * q.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	if k > 0 {
+		penalty += k * 10
+	}
+	return penalty
+}
+
+// 连续 5 个及以上同色模块，以及类似定位图形的 1:1:3:1:1 图形
+func linePenalty(line []bool) int {
+	penalty := 0
+	run := 1
+	for i := 1; i <= len(line); i++ {
+		if i < len(line) && line[i] == line[i-1] {
+			run++
+			continue
+		}
+		if run >= 5 {
+			penalty += run - 2
+		}
+		run = 1
+	}
+	finder := []bool{true, false, true, true, true, false, true}
+	for i := 0; i+len(finder) <= len(line); i++ {
+		if !matches(line[i:], finder) {
+			continue
+		}
+		// 一侧有 4 个浅色模块(包括静区)
+		if lightRange(line, i-4, i) || lightRange(line, i+len(finder), i+len(finder)+4) {
+			penalty += 40
+		}
+	}
+	return penalty
+}
+
+func matches(line, pattern []bool) bool {
+	for i, b := range pattern {
+		if line[i] != b {
+			return false
+		}
+	}
+	return true
+}
+
+// [from, to) 范围内均为浅色，超出范围的部分视为静区
+func lightRange(line []bool, from, to int) bool {
+	for i := from; i < to; i++ {
+		if i >= 0 && i < len(line) && line[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 版本的数据模块数(包括纠错码及剩余位)
+func qrRawDataModules(version int) int {
+	result := (16*version+128)*version + 64
+	if version >= 2 {
+		n := version/7 + 2
+		result -= (25*n-10)*n - 55
+		if version >= 7 {
+			result -= 36
+		}
+	}
+	return result
+}
+
+// 版本的数据码字数(不包括纠错码)
+func qrDataCodewords(version int, level QRLevel) int {
+	return qrRawDataModules(version)/8 - qrECCCodewordsPerBlock[level][version]*qrECCBlocks[level][version]
+}
+
+// 字节模式下字符数指示符的位数
+func qrCountBits(version int) int {
+	if version <= 9 {
+		return 8
+	}
+	return 16
+}
+
+// 字节模式编码 n 字节所需位数
+func qrDataBits(version, n int) int {
+	if n >= 1<<qrCountBits(version) {
+		return 1 << 30
+	}
+	return 4 + qrCountBits(version) + n*8
+}
+
+// Reed-Solomon 生成多项式
+func rsDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// Reed-Solomon 纠错码
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, d := range divisor {
+			result[i] ^= gfMultiply(d, factor)
+		}
+	}
+	return result
+}
+
+// GF(2^8) 乘法，本原多项式 0x11D
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = (z << 1) ^ ((z >> 7) * 0x11D)
+		z ^= int((y>>uint(i))&1) * int(x)
+	}
+	return byte(z)
+}
+
+type bitBuffer struct {
+	bits []bool
+}
+
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		b.bits = append(b.bits, (value>>uint(i))&1 != 0)
+	}
+}
+
+func (b *bitBuffer) len() int {
+	return len(b.bits)
+}
+
+func (b *bitBuffer) bytes() []byte {
+	data := make([]byte, len(b.bits)/8)
+	for i, v := range b.bits {
+		if v {
+			data[i>>3] |= 1 << uint(7-i&7)
+		}
+	}
+	return data
+}
+
+func bit(x, i int) bool {
+	return (x>>uint(i))&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
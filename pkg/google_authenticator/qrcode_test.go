@@ -0,0 +1,121 @@
+package google_authenticator_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/morgine/moon/pkg/google_authenticator"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEncodeQRCode(t *testing.T) {
+	// 版本 2，与 rsc.io/qr 以相同掩码编码的结果一致
+	need := []string{
+		"#######....##.#...#######",
+		"#.....#.#....#....#.....#",
+		"#.###.#..#..#..#..#.###.#",
+		"#.###.#..#.#.#....#.###.#",
+		"#.###.#.##.###..#.#.###.#",
+		"#.....#...##..###.#.....#",
+		"#######.#.#.#.#.#.#######",
+		".........##.#..#.........",
+		"#.#.#.#...#.....#...#..#.",
+		".##.##.#..#..#..####.#..#",
+		"...##.#..#.#..#..#.#..###",
+		"#.###...#...###.#.#.#..#.",
+		"...#######....#####....##",
+		".##.#.....##..#...##.#..#",
+		"#.##..#####..#..###..####",
+		".#####..#..#...#.#.##...#",
+		"#.#...#.##..#...######.#.",
+		"........######..#...#..##",
+		"#######..####.###.#.#####",
+		"#.....#..#..###.#...#..#.",
+		"#.###.#.####..#.######..#",
+		"#.###.#....#..##....#....",
+		"#.###.#.#.#..#.##...#.#.#",
+		"#.....#...##....#.##...#.",
+		"#######.###.#..###.....##",
+	}
+	q, err := google_authenticator.EncodeQRCode([]byte("otpauth://totp/a"), google_authenticator.QRLevelM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Size != len(need) {
+		t.Fatalf("need size: %d, got: %d\n", len(need), q.Size)
+	}
+	for y, row := range need {
+		for x, c := range row {
+			if q.Black(x, y) != (c == '#') {
+				t.Fatalf("module (%d, %d) need: %t, got: %t\n", x, y, c == '#', q.Black(x, y))
+			}
+		}
+	}
+	// 版本 1 L 级最多 17 字节
+	for n, size := range map[int]int{17: 21, 18: 25, 2953: 177} {
+		q, err = google_authenticator.EncodeQRCode(make([]byte, n), google_authenticator.QRLevelL)
+		if err != nil || q.Size != size {
+			t.Errorf("%d bytes need size: %d, got: %v, %v\n", n, size, q, err)
+		}
+	}
+	if _, err = google_authenticator.EncodeQRCode(make([]byte, 2954), google_authenticator.QRLevelL); err != google_authenticator.ErrQRCodeTooLong {
+		t.Errorf("need: %v, got: %v\n", google_authenticator.ErrQRCodeTooLong, err)
+	}
+}
+
+func TestQRCode_Image(t *testing.T) {
+	q, err := google_authenticator.EncodeQRCode([]byte("otpauth://totp/a"), google_authenticator.QRLevelM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := q.Image(google_authenticator.PNG, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 25 个模块加两侧各 4 个模块的留白，每模块 6 像素
+	if bounds := img.Bounds(); bounds.Dx() != 198 || bounds.Dy() != 198 {
+		t.Errorf("need: 198x198, got: %dx%d\n", bounds.Dx(), bounds.Dy())
+	}
+	// 左上角定位图形从留白之后开始
+	if r, _, _, _ := img.At(4*6, 4*6).RGBA(); r != 0 {
+		t.Error("need black finder pattern")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("need white quiet zone")
+	}
+	svg, err := q.Image(google_authenticator.SVG, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := string(svg); !strings.HasPrefix(s, "<svg") || !strings.Contains(s, `viewBox="0 0 33 33"`) || !strings.Contains(s, `width="200"`) {
+		t.Errorf("unexpected svg: %s\n", s)
+	}
+	if _, err = q.Image("gif", 200); err != google_authenticator.ErrUnsupportedImageFormat {
+		t.Errorf("need: %v, got: %v\n", google_authenticator.ErrUnsupportedImageFormat, err)
+	}
+}
+
+func TestClient_GetQRCodeURI(t *testing.T) {
+	client := google_authenticator.NewClient(google_authenticator.Config{})
+	uri := client.GetQRCodeURI("12345678901234567890", "user", 200, 200)
+	prefix := "data:image/png;base64,"
+	if !strings.HasPrefix(uri, prefix) {
+		t.Fatalf("need local data uri, got: %s\n", uri)
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(uri, prefix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := client.QRCode("12345678901234567890", "user", google_authenticator.PNG, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, image) {
+		t.Error("need data uri same as image")
+	}
+}
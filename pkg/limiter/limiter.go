@@ -0,0 +1,93 @@
+package limiter
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// 次数限制器，业务代码依赖该接口，可在内存及 Redis 等实现之间替换
+type Limiter interface {
+	// 获得限制剩余时间，已解除的限制返回 0
+	CheckLimit(ctx context.Context, key string) (limitIn, clearIn time.Duration, err error)
+
+	// 增加一次次数，并返回限制剩余时间
+	AddOneTimes(ctx context.Context, key string) (limitIn, clearIn time.Duration, err error)
+
+	// 检查并记录一次次数，已被限制则不记录且 allowed 为 false，limitIn 为剩余限制时间，
+	// 否则记录一次次数且 allowed 为 true，limitIn 为记录本次次数后的限制时间
+	CheckAndAdd(ctx context.Context, key string) (allowed bool, limitIn time.Duration, err error)
+
+	// 解除限制
+	RemoveLimit(ctx context.Context, key string) error
+}
+
+// 限制查询接口，用于管理后台查看限制，内存及 Redis 限制器均实现了该接口
+type Inspector interface {
+	// 获得未达到清除时间的限制
+	Get(ctx context.Context, key string) (limit Limit, ok bool, err error)
+
+	// 按 key 排序列出以 prefix 开头且未达到清除时间的限制，跳过 offset 条后最多返回 limit 条，limit <= 0 表示不限制条数，
+	// total 为符合条件的总条数
+	List(ctx context.Context, prefix string, offset, limit int) (limits []KeyLimit, total int, err error)
+}
+
+type memoryLimiter struct {
+	ts *TimesLimiter
+}
+
+// 将内存次数限制器适配为 Limiter 接口，限制状态仅在当前进程中有效
+func NewMemoryLimiter(ts *TimesLimiter) Limiter {
+	return &memoryLimiter{ts: ts}
+}
+
+func (m *memoryLimiter) CheckLimit(ctx context.Context, key string) (limitIn, clearIn time.Duration, err error) {
+	limitIn, clearIn = m.ts.CheckLimit(key)
+	return limitIn, clearIn, nil
+}
+
+func (m *memoryLimiter) AddOneTimes(ctx context.Context, key string) (limitIn, clearIn time.Duration, err error) {
+	limitIn, clearIn = m.ts.AddOneTimes(key)
+	return limitIn, clearIn, nil
+}
+
+func (m *memoryLimiter) CheckAndAdd(ctx context.Context, key string) (allowed bool, limitIn time.Duration, err error) {
+	allowed, limitIn = m.ts.CheckAndAdd(key)
+	return allowed, limitIn, nil
+}
+
+func (m *memoryLimiter) RemoveLimit(ctx context.Context, key string) error {
+	m.ts.RemoveLimit(key)
+	return nil
+}
+
+func (m *memoryLimiter) Get(ctx context.Context, key string) (limit Limit, ok bool, err error) {
+	limit, ok = m.ts.Get(key)
+	return limit, ok, nil
+}
+
+func (m *memoryLimiter) List(ctx context.Context, prefix string, offset, limit int) (limits []KeyLimit, total int, err error) {
+	limits, total = m.ts.List(prefix, offset, limit)
+	return limits, total, nil
+}
+
+func sortKeyLimits(limits []KeyLimit) {
+	sort.Slice(limits, func(i, j int) bool {
+		return limits[i].Key < limits[j].Key
+	})
+}
+
+// 分页，offset 超出范围时返回空
+func paginate(limits []KeyLimit, offset, limit int) []KeyLimit {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(limits) {
+		return nil
+	}
+	limits = limits[offset:]
+	if limit > 0 && limit < len(limits) {
+		limits = limits[:limit]
+	}
+	return limits
+}
@@ -0,0 +1,131 @@
+package limiter_test
+
+import (
+	"context"
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/pkg/x_time"
+	"testing"
+	"time"
+)
+
+// 限制器行为测试，所有 limiter.Limiter 实现都需要通过该测试，newLimiter 返回的限制器需要使用 stepProvider 及 clock
+func testLimiter(t *testing.T, newLimiter func(clock x_time.Clock) limiter.Limiter) {
+	ctx := context.Background()
+	now := time.Now()
+	clock := x_time.NewFake(now)
+	l := newLimiter(clock)
+	callAt(clock, now, func() {
+		for i := 1; i <= 7; i++ {
+			_, _, err := l.AddOneTimes(ctx, "user_01")
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		limitIn, clearIn, err := l.CheckLimit(ctx, "user_01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if limitIn != 2*time.Minute || clearIn != 4*time.Minute {
+			t.Errorf("need: 2m, 4m, got: %v, %v\n", limitIn, clearIn)
+		}
+		// 已被限制时不记录次数
+		allowed, limitIn, err := l.CheckAndAdd(ctx, "user_01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if allowed || limitIn != 2*time.Minute {
+			t.Errorf("need: false, 2m, got: %t, %v\n", allowed, limitIn)
+		}
+	})
+	// 限制解除后仍需等待清除时间
+	callAt(clock, now.Add(3*time.Minute), func() {
+		limitIn, clearIn, _ := l.CheckLimit(ctx, "user_01")
+		if limitIn != 0 || clearIn != time.Minute {
+			t.Errorf("need: 0, 1m, got: %v, %v\n", limitIn, clearIn)
+		}
+		// 第 8 次
+		allowed, limitIn, _ := l.CheckAndAdd(ctx, "user_01")
+		if !allowed || limitIn != 3*time.Minute {
+			t.Errorf("need: true, 3m, got: %t, %v\n", allowed, limitIn)
+		}
+	})
+	// 达到清除时间后重新计数
+	callAt(clock, now.Add(10*time.Minute), func() {
+		limitIn, clearIn, _ := l.CheckLimit(ctx, "user_01")
+		if limitIn != 0 || clearIn != 0 {
+			t.Errorf("need: 0, 0, got: %v, %v\n", limitIn, clearIn)
+		}
+		for i := 1; i <= 6; i++ {
+			limitIn, clearIn, _ = l.AddOneTimes(ctx, "user_01")
+		}
+		if limitIn != time.Minute || clearIn != 2*time.Minute {
+			t.Errorf("need: 1m, 2m, got: %v, %v\n", limitIn, clearIn)
+		}
+		err := l.RemoveLimit(ctx, "user_01")
+		if err != nil {
+			t.Fatal(err)
+		}
+		limitIn, _, _ = l.CheckLimit(ctx, "user_01")
+		if limitIn != 0 {
+			t.Errorf("need: 0 after remove, got: %v\n", limitIn)
+		}
+	})
+}
+
+// 限制查询测试，newInspector 返回的限制器需要使用 stepProvider 及 clock
+func testInspector(t *testing.T, newInspector func(clock x_time.Clock) interface {
+	limiter.Limiter
+	limiter.Inspector
+}) {
+	ctx := context.Background()
+	now := time.Now()
+	clock := x_time.NewFake(now)
+	l := newInspector(clock)
+	callAt(clock, now, func() {
+		for _, key := range []string{"login_ip:3", "login_ip:1", "login_ip:2", "login_username:a", "login_ip*"} {
+			for i := 0; i < 6; i++ {
+				_, _, _ = l.AddOneTimes(ctx, key)
+			}
+		}
+		_, _, _ = l.AddOneTimes(ctx, "login_ip:4")
+		limit, ok, err := l.Get(ctx, "login_ip:1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Redis 实现以毫秒精度保存时间
+		if !ok || limit.Times != 6 || limit.LimitAt == nil || now.Add(time.Minute).Sub(*limit.LimitAt) >= time.Millisecond {
+			t.Errorf("need: 6 times limited in 1m, got: %t %+v\n", ok, limit)
+		}
+		limit, ok, _ = l.Get(ctx, "login_ip:4")
+		// 未达到限制的次数同样在 2 分钟后清除
+		if !ok || limit.Times != 1 || limit.LimitAt != nil || limit.ClearAt == nil || now.Add(2*time.Minute).Sub(*limit.ClearAt) >= time.Millisecond {
+			t.Errorf("need: 1 times without limit cleared in 2m, got: %t %+v\n", ok, limit)
+		}
+		if _, ok, _ = l.Get(ctx, "not_exist"); ok {
+			t.Error("need: not found, got: found")
+		}
+		limits, total, err := l.List(ctx, "login_ip:", 1, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 4 || len(limits) != 2 || limits[0].Key != "login_ip:2" || limits[1].Key != "login_ip:3" {
+			t.Errorf("need: 4 [login_ip:2 login_ip:3], got: %d %v\n", total, limits)
+		}
+		// 前缀中的通配符按普通字符匹配
+		if _, total, _ = l.List(ctx, "login_ip*", 0, 0); total != 1 {
+			t.Errorf("need: 1, got: %d\n", total)
+		}
+		if limits, total, _ = l.List(ctx, "", 10, 10); total != 6 || len(limits) != 0 {
+			t.Errorf("need: 6 [], got: %d %v\n", total, limits)
+		}
+	})
+	// 达到清除时间的限制不再列出
+	callAt(clock, now.Add(3*time.Minute), func() {
+		if _, total, _ := l.List(ctx, "", 0, 0); total != 0 {
+			t.Errorf("need: 0, got: %d\n", total)
+		}
+		if _, ok, _ := l.Get(ctx, "login_ip:1"); ok {
+			t.Error("need: not found, got: found")
+		}
+	})
+}
@@ -0,0 +1,268 @@
+package limiter
+
+import (
+	"fmt"
+	"github.com/morgine/moon/pkg/x_time"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 前 free 次不限制(次数在 clearBase 后清除)，之后限制时间及清除时间按次数线性递增，
+// 如 Linear(5, time.Minute, 2*time.Minute) 第 6 次限制 1 分钟，第 7 次限制 2 分钟
+func Linear(free int, limitBase, clearBase time.Duration) LimitTimeProvider {
+	return func(times int) (limitIn, clearIn time.Duration) {
+		if times <= free {
+			return 0, clearBase
+		}
+		n := time.Duration(times - free)
+		return n * limitBase, n * clearBase
+	}
+}
+
+// 前 free 次不限制(次数在 clearBase 后清除)，之后限制时间及清除时间按次数翻倍，限制时间最长为 max，清除时间按相同比例封顶，
+// 如 Exponential(3, time.Minute, 2*time.Minute, time.Hour) 第 4 次限制 1 分钟，第 5 次限制 2 分钟，最长限制 1 小时
+func Exponential(free int, limitBase, clearBase, max time.Duration) LimitTimeProvider {
+	maxClear := max
+	if limitBase > 0 {
+		maxClear = time.Duration(float64(max) * float64(clearBase) / float64(limitBase))
+	}
+	return func(times int) (limitIn, clearIn time.Duration) {
+		if times <= free {
+			return 0, clearBase
+		}
+		limitIn, clearIn = limitBase, clearBase
+		for i := free + 1; i < times && limitIn < max; i++ {
+			limitIn *= 2
+			clearIn *= 2
+		}
+		if limitIn > max {
+			limitIn = max
+		}
+		if clearIn > maxClear {
+			clearIn = maxClear
+		}
+		return limitIn, clearIn
+	}
+}
+
+// 阶梯限制，达到 Times 次后使用对应的限制时间及清除时间
+type Step struct {
+	Times   int
+	LimitIn time.Duration
+	ClearIn time.Duration
+}
+
+// 按阶梯表限制，使用次数不超过当前次数的最大阶梯，未达到任何阶梯时不限制，次数在第一个阶梯的清除时间后清除
+func Steps(steps ...Step) LimitTimeProvider {
+	steps = append([]Step{}, steps...)
+	sort.Slice(steps, func(i, j int) bool {
+		return steps[i].Times < steps[j].Times
+	})
+	return func(times int) (limitIn, clearIn time.Duration) {
+		i := sort.Search(len(steps), func(i int) bool {
+			return steps[i].Times > times
+		})
+		if i == 0 {
+			if len(steps) == 0 {
+				return 0, 0
+			}
+			return 0, steps[0].ClearIn
+		}
+		return steps[i-1].LimitIn, steps[i-1].ClearIn
+	}
+}
+
+// 阶梯配置，时间长度可使用 "1m" 等格式
+type StepConfig struct {
+	Times   int             `toml:"times"`
+	LimitIn x_time.Duration `toml:"limit_in"`
+	ClearIn x_time.Duration `toml:"clear_in"`
+}
+
+func (c StepConfig) Step() Step {
+	return Step{Times: c.Times, LimitIn: c.LimitIn.Duration(), ClearIn: c.ClearIn.Duration()}
+}
+
+// 为限制时间增加 ±factor 比例的随机抖动，避免大量被限制的请求在同一时间解除限制，
+// 清除时间随限制时间平移，保证清除时间不早于限制时间
+func Jitter(provider LimitTimeProvider, factor float64) LimitTimeProvider {
+	return func(times int) (limitIn, clearIn time.Duration) {
+		limitIn, clearIn = provider(times)
+		if limitIn <= 0 || factor <= 0 {
+			return
+		}
+		delta := time.Duration((rand.Float64()*2 - 1) * factor * float64(limitIn))
+		limitIn += delta
+		if clearIn > 0 {
+			clearIn += delta
+		}
+		return
+	}
+}
+
+// 限制策略
+const (
+	PolicyLinear      = "linear"
+	PolicyExponential = "exponential"
+	PolicySteps       = "steps"
+)
+
+/*
+# 登陆限制策略: linear、exponential、steps
+[login_limit]
+policy = "exponential"
+# 不限制的次数
+free = 5
+# 限制时间基数，时间长度使用 "1m"、"1h30m" 等格式
+limit = "1m"
+# 清除时间基数
+clear = "2m"
+# exponential 策略的最长限制时间
+max = "1h"
+# 限制时间随机抖动比例
+jitter = 0.1
+# steps 策略的阶梯表
+# [[login_limit.steps]]
+# times = 5
+# limit_in = "1m"
+# clear_in = "10m"
+*/
+type ProviderConfig struct {
+	Policy string          `toml:"policy"`
+	Free   int             `toml:"free"`
+	Limit  x_time.Duration `toml:"limit"`
+	Clear  x_time.Duration `toml:"clear"`
+	Max    x_time.Duration `toml:"max"`
+	Jitter float64         `toml:"jitter"`
+	Steps  []StepConfig    `toml:"steps"`
+}
+
+// 根据配置创建 LimitTimeProvider
+func (c ProviderConfig) Provider() (LimitTimeProvider, error) {
+	var provider LimitTimeProvider
+	switch c.Policy {
+	case PolicyLinear:
+		if c.Limit <= 0 {
+			return nil, fmt.Errorf("limiter: %s policy requires limit", c.Policy)
+		}
+		provider = Linear(c.Free, c.Limit.Duration(), c.Clear.Duration())
+	case PolicyExponential:
+		if c.Limit <= 0 || c.Max < c.Limit {
+			return nil, fmt.Errorf("limiter: %s policy requires limit and max >= limit", c.Policy)
+		}
+		provider = Exponential(c.Free, c.Limit.Duration(), c.Clear.Duration(), c.Max.Duration())
+	case PolicySteps:
+		if len(c.Steps) == 0 {
+			return nil, fmt.Errorf("limiter: %s policy requires steps", c.Policy)
+		}
+		steps := make([]Step, len(c.Steps))
+		for i, step := range c.Steps {
+			steps[i] = step.Step()
+		}
+		provider = Steps(steps...)
+	default:
+		return nil, fmt.Errorf("limiter: unknown policy %q", c.Policy)
+	}
+	if c.Jitter < 0 || c.Jitter >= 1 {
+		return nil, fmt.Errorf("limiter: jitter must be in [0, 1), got %v", c.Jitter)
+	}
+	if c.Jitter > 0 {
+		provider = Jitter(provider, c.Jitter)
+	}
+	return provider, nil
+}
+
+// 解析配置字符串，格式为策略名后跟空格分隔的 key=value 参数，steps 策略的阶梯格式为 次数:限制时间/清除时间，如:
+//
+//	linear free=5 limit=1m clear=2m
+//	exponential free=3 limit=1m clear=2m max=1h jitter=0.1
+//	steps 5:1m/10m 10:1h/24h
+func ParseProviderConfig(s string) (ProviderConfig, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return ProviderConfig{}, fmt.Errorf("limiter: empty policy")
+	}
+	c := ProviderConfig{Policy: fields[0]}
+	for _, field := range fields[1:] {
+		var err error
+		if c.Policy == PolicySteps && !strings.Contains(field, "=") {
+			var step StepConfig
+			step, err = parseStep(field)
+			c.Steps = append(c.Steps, step)
+		} else {
+			err = c.set(field)
+		}
+		if err != nil {
+			return ProviderConfig{}, err
+		}
+	}
+	return c, nil
+}
+
+// 解析配置字符串并创建 LimitTimeProvider
+func ParseProvider(s string) (LimitTimeProvider, error) {
+	c, err := ParseProviderConfig(s)
+	if err != nil {
+		return nil, err
+	}
+	return c.Provider()
+}
+
+func (c *ProviderConfig) set(field string) (err error) {
+	kv := strings.SplitN(field, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("limiter: invalid parameter %q", field)
+	}
+	switch kv[0] {
+	case "free":
+		c.Free, err = strconv.Atoi(kv[1])
+	case "limit":
+		c.Limit, err = parseDuration(kv[1])
+	case "clear":
+		c.Clear, err = parseDuration(kv[1])
+	case "max":
+		c.Max, err = parseDuration(kv[1])
+	case "jitter":
+		c.Jitter, err = strconv.ParseFloat(kv[1], 64)
+	default:
+		return fmt.Errorf("limiter: unknown parameter %q", kv[0])
+	}
+	if err != nil {
+		return fmt.Errorf("limiter: invalid parameter %q: %v", field, err)
+	}
+	return nil
+}
+
+// 解析 次数:限制时间/清除时间 格式的阶梯
+func parseStep(field string) (step StepConfig, err error) {
+	invalid := func() (StepConfig, error) {
+		return StepConfig{}, fmt.Errorf("limiter: invalid step %q", field)
+	}
+	parts := strings.SplitN(field, ":", 2)
+	if len(parts) != 2 {
+		return invalid()
+	}
+	durations := strings.SplitN(parts[1], "/", 2)
+	if len(durations) != 2 {
+		return invalid()
+	}
+	if step.Times, err = strconv.Atoi(parts[0]); err != nil {
+		return invalid()
+	}
+	if step.LimitIn, err = parseDuration(durations[0]); err != nil {
+		return invalid()
+	}
+	if step.ClearIn, err = parseDuration(durations[1]); err != nil {
+		return invalid()
+	}
+	return step, nil
+}
+
+// 配置字符串中的时间长度必须带单位
+func parseDuration(s string) (x_time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	return x_time.Duration(d), err
+}
@@ -0,0 +1,147 @@
+package limiter_test
+
+import (
+	"github.com/BurntSushi/toml"
+	"github.com/morgine/moon/pkg/limiter"
+	"testing"
+	"time"
+)
+
+type providerCase struct {
+	times   int
+	limitIn time.Duration
+	clearIn time.Duration
+}
+
+func testProvider(t *testing.T, name string, provider limiter.LimitTimeProvider, cases []providerCase) {
+	for _, c := range cases {
+		limitIn, clearIn := provider(c.times)
+		if limitIn != c.limitIn || clearIn != c.clearIn {
+			t.Errorf("%s %d need: %v %v, got: %v %v\n", name, c.times, c.limitIn, c.clearIn, limitIn, clearIn)
+		}
+	}
+}
+
+func TestProviders(t *testing.T) {
+	// 未达到限制的次数同样会被清除
+	testProvider(t, "linear", limiter.Linear(5, time.Minute, 2*time.Minute), []providerCase{
+		{times: 1, clearIn: 2 * time.Minute},
+		{times: 5, clearIn: 2 * time.Minute},
+		{times: 6, limitIn: time.Minute, clearIn: 2 * time.Minute},
+		{times: 8, limitIn: 3 * time.Minute, clearIn: 6 * time.Minute},
+	})
+	testProvider(t, "exponential", limiter.Exponential(3, time.Minute, 2*time.Minute, 10*time.Minute), []providerCase{
+		{times: 3, clearIn: 2 * time.Minute},
+		{times: 4, limitIn: time.Minute, clearIn: 2 * time.Minute},
+		{times: 5, limitIn: 2 * time.Minute, clearIn: 4 * time.Minute},
+		{times: 7, limitIn: 8 * time.Minute, clearIn: 16 * time.Minute},
+		{times: 8, limitIn: 10 * time.Minute, clearIn: 20 * time.Minute},
+		{times: 1000000, limitIn: 10 * time.Minute, clearIn: 20 * time.Minute},
+	})
+	testProvider(t, "steps", limiter.Steps(
+		limiter.Step{Times: 10, LimitIn: time.Hour, ClearIn: 24 * time.Hour},
+		limiter.Step{Times: 5, LimitIn: time.Minute, ClearIn: 10 * time.Minute},
+	), []providerCase{
+		{times: 4, clearIn: 10 * time.Minute},
+		{times: 5, limitIn: time.Minute, clearIn: 10 * time.Minute},
+		{times: 9, limitIn: time.Minute, clearIn: 10 * time.Minute},
+		{times: 12, limitIn: time.Hour, clearIn: 24 * time.Hour},
+	})
+}
+
+func TestJitter(t *testing.T) {
+	provider := limiter.Jitter(limiter.Linear(0, 10*time.Minute, 20*time.Minute), 0.1)
+	for i := 0; i < 100; i++ {
+		limitIn, clearIn := provider(1)
+		if limitIn < 9*time.Minute || limitIn > 11*time.Minute {
+			t.Fatalf("limitIn need: 9m-11m, got: %v\n", limitIn)
+		}
+		if clearIn-limitIn != 10*time.Minute {
+			t.Fatalf("clearIn need: limitIn+10m, got: %v %v\n", limitIn, clearIn)
+		}
+	}
+	// 未限制时不抖动
+	if limitIn, clearIn := limiter.Jitter(limiter.Linear(5, time.Minute, time.Minute), 0.5)(1); limitIn != 0 || clearIn != time.Minute {
+		t.Errorf("need: 0 1m, got: %v %v\n", limitIn, clearIn)
+	}
+}
+
+func TestParseProvider(t *testing.T) {
+	config, err := limiter.ParseProviderConfig("steps 10:1h/24h 5:1m/10m jitter=0.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.Steps) != 2 || config.Steps[0].Step() != (limiter.Step{Times: 10, LimitIn: time.Hour, ClearIn: 24 * time.Hour}) || config.Jitter != 0.2 {
+		t.Errorf("got: %+v\n", config)
+	}
+	provider, err := limiter.ParseProvider("exponential free=3 limit=1m clear=2m max=10m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testProvider(t, "parsed exponential", provider, []providerCase{
+		{times: 3, clearIn: 2 * time.Minute},
+		{times: 5, limitIn: 2 * time.Minute, clearIn: 4 * time.Minute},
+		{times: 9, limitIn: 10 * time.Minute, clearIn: 20 * time.Minute},
+	})
+	provider, err = limiter.ParseProvider("linear free=5 limit=1m clear=2m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testProvider(t, "parsed linear", provider, []providerCase{
+		{times: 7, limitIn: 2 * time.Minute, clearIn: 4 * time.Minute},
+	})
+	for _, s := range []string{
+		"",
+		"unknown",
+		"linear",
+		"linear limit=1m foo=1",
+		"linear limit=1",
+		"linear limit=1m jitter=1",
+		"exponential limit=1h max=1m",
+		"steps",
+		"steps 5:1m",
+		"steps x:1m/2m",
+	} {
+		if _, err := limiter.ParseProvider(s); err == nil {
+			t.Errorf("%q need error, got: nil\n", s)
+		}
+	}
+}
+
+func TestProviderConfig_TOML(t *testing.T) {
+	// ProviderConfig 文档中的配置示例
+	var config struct {
+		LoginLimit limiter.ProviderConfig `toml:"login_limit"`
+	}
+	_, err := toml.Decode(`
+[login_limit]
+policy = "exponential"
+free = 5
+limit = "1m"
+clear = "2m"
+max = "1h"
+jitter = 0.1
+[[login_limit.steps]]
+times = 5
+limit_in = "1m"
+clear_in = "10m"
+`, &config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := config.LoginLimit
+	if c.Limit.Duration() != time.Minute || c.Clear.Duration() != 2*time.Minute || c.Max.Duration() != time.Hour ||
+		len(c.Steps) != 1 || c.Steps[0].Step() != (limiter.Step{Times: 5, LimitIn: time.Minute, ClearIn: 10 * time.Minute}) {
+		t.Errorf("got: %+v\n", c)
+	}
+	if _, err = c.Provider(); err != nil {
+		t.Error(err)
+	}
+	// 兼容整数纳秒
+	if _, err = toml.Decode("limit = 60000000000", &config.LoginLimit); err != nil || config.LoginLimit.Limit.Duration() != time.Minute {
+		t.Errorf("need: 1m, got: %v, %v\n", config.LoginLimit.Limit, err)
+	}
+	if _, err = toml.Decode(`limit = "1x"`, &config.LoginLimit); err == nil {
+		t.Error("need error, got: nil")
+	}
+}
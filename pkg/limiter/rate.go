@@ -0,0 +1,162 @@
+package limiter
+
+import (
+	"github.com/morgine/moon/pkg/x_time"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 速率限制结果，字段含义与 RateLimit-* 响应头一致
+type RateResult struct {
+	Allowed    bool          // 是否允许本次请求
+	Limit      int           // 配额上限
+	Remaining  int           // 剩余配额
+	Reset      time.Duration // 配额完全恢复的剩余时间
+	RetryAfter time.Duration // 请求被拒绝时需要等待的时间
+}
+
+// 速率限制器，用于限制每个 key 单位时间内的请求数
+type RateLimiter interface {
+	// 记录一次请求并返回限制结果，请求被拒绝时不消耗配额
+	Allow(key string) RateResult
+}
+
+// 令牌桶配置，令牌以 Rate/Period 的速度生成，桶满时最多允许 Burst 个突发请求
+type TokenBucketConfig struct {
+	Rate    int           // 每个周期生成的令牌数
+	Period  time.Duration // 令牌生成周期
+	Burst   int           // 桶容量，0 表示与 Rate 相同
+	MaxKeys int           // 最大 key 数量，超出后淘汰最久未使用的 key，0 表示不限制
+	Clock   x_time.Clock  // 时钟，为空则使用系统时间
+}
+
+// 令牌桶限制器，允许短时间的突发请求，长期速率不超过 Rate/Period
+type TokenBucket struct {
+	burst float64
+	rate  float64 // 每秒生成的令牌数
+	keys  *keyStore
+	clock x_time.Clock
+	mu    sync.Mutex
+}
+
+type bucket struct {
+	tokens   float64
+	updateAt time.Time
+}
+
+// Rate 或 Period 不为正数时 panic
+func NewTokenBucket(c TokenBucketConfig) *TokenBucket {
+	if c.Rate <= 0 {
+		panic("limiter: token bucket rate must be positive, got " + strconv.Itoa(c.Rate))
+	}
+	if c.Period <= 0 {
+		panic("limiter: token bucket period must be positive, got " + c.Period.String())
+	}
+	if c.Burst <= 0 {
+		c.Burst = c.Rate
+	}
+	rate := float64(c.Rate) / c.Period.Seconds()
+	// 空闲到桶满所需时间后，状态与新建的桶相同
+	idle := time.Duration(float64(c.Burst) / rate * float64(time.Second))
+	return &TokenBucket{
+		burst: float64(c.Burst),
+		rate:  rate,
+		keys:  newKeyStore(c.MaxKeys, idle),
+		clock: x_time.Or(c.Clock),
+	}
+}
+
+func (tb *TokenBucket) Allow(key string) RateResult {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	now := tb.clock.Now()
+	b := tb.keys.get(key, now, func() interface{} {
+		return &bucket{tokens: tb.burst, updateAt: now}
+	}).(*bucket)
+	b.tokens = math.Min(tb.burst, b.tokens+now.Sub(b.updateAt).Seconds()*tb.rate)
+	b.updateAt = now
+	result := RateResult{Limit: int(tb.burst)}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = tb.duration(1 - b.tokens)
+	}
+	result.Remaining = int(b.tokens)
+	result.Reset = tb.duration(tb.burst - b.tokens)
+	return result
+}
+
+// 生成 tokens 个令牌所需的时间
+func (tb *TokenBucket) duration(tokens float64) time.Duration {
+	return time.Duration(math.Ceil(tokens / tb.rate * float64(time.Second)))
+}
+
+// 滑动窗口配置
+type SlidingWindowConfig struct {
+	Limit   int           // 窗口内允许的请求数
+	Window  time.Duration // 窗口大小
+	MaxKeys int           // 最大 key 数量，超出后淘汰最久未使用的 key，0 表示不限制
+	Clock   x_time.Clock  // 时钟，为空则使用系统时间
+}
+
+// 滑动窗口日志限制器，记录窗口内每次请求的时间，任意 Window 时间内的请求数都不超过 Limit
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	keys   *keyStore
+	clock  x_time.Clock
+	mu     sync.Mutex
+}
+
+// 窗口内的请求时间，按时间顺序排列
+type requestLog struct {
+	times []time.Time
+}
+
+// Limit 或 Window 不为正数时 panic
+func NewSlidingWindow(c SlidingWindowConfig) *SlidingWindow {
+	if c.Limit <= 0 {
+		panic("limiter: sliding window limit must be positive, got " + strconv.Itoa(c.Limit))
+	}
+	if c.Window <= 0 {
+		panic("limiter: sliding window must be positive, got " + c.Window.String())
+	}
+	return &SlidingWindow{
+		limit:  c.Limit,
+		window: c.Window,
+		keys:   newKeyStore(c.MaxKeys, c.Window),
+		clock:  x_time.Or(c.Clock),
+	}
+}
+
+func (sw *SlidingWindow) Allow(key string) RateResult {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := sw.clock.Now()
+	log := sw.keys.get(key, now, func() interface{} {
+		return &requestLog{times: make([]time.Time, 0, sw.limit)}
+	}).(*requestLog)
+	// 删除窗口外的请求
+	start := now.Add(-sw.window)
+	expired := 0
+	for expired < len(log.times) && !log.times[expired].After(start) {
+		expired++
+	}
+	log.times = append(log.times[:0], log.times[expired:]...)
+
+	result := RateResult{Limit: sw.limit}
+	if len(log.times) < sw.limit {
+		log.times = append(log.times, now)
+		result.Allowed = true
+	} else {
+		result.RetryAfter = log.times[0].Add(sw.window).Sub(now)
+	}
+	result.Remaining = sw.limit - len(log.times)
+	if len(log.times) > 0 {
+		result.Reset = log.times[len(log.times)-1].Add(sw.window).Sub(now)
+	}
+	return result
+}
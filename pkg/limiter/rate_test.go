@@ -0,0 +1,97 @@
+package limiter_test
+
+import (
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/pkg/x_time"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Now()
+	// 每秒 1 个令牌，最多 3 个突发请求
+	clock := x_time.NewFake(now)
+	tb := limiter.NewTokenBucket(limiter.TokenBucketConfig{Rate: 1, Period: time.Second, Burst: 3, Clock: clock})
+	type testcase struct {
+		at     time.Duration
+		result limiter.RateResult
+	}
+	var testcases = []testcase{
+		{at: 0, result: limiter.RateResult{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{at: 0, result: limiter.RateResult{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{at: 0, result: limiter.RateResult{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{at: 0, result: limiter.RateResult{Allowed: false, Limit: 3, Remaining: 0, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		{at: 500 * time.Millisecond, result: limiter.RateResult{Allowed: false, Limit: 3, Remaining: 0, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{at: time.Second, result: limiter.RateResult{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{at: 10 * time.Second, result: limiter.RateResult{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+	}
+	for i, tc := range testcases {
+		callAt(clock, now.Add(tc.at), func() {
+			if got := tb.Allow("user_01"); got != tc.result {
+				t.Errorf("%d need: %+v, got: %+v\n", i, tc.result, got)
+			}
+		})
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	now := time.Now()
+	// 每分钟最多 2 次请求
+	clock := x_time.NewFake(now)
+	sw := limiter.NewSlidingWindow(limiter.SlidingWindowConfig{Limit: 2, Window: time.Minute, Clock: clock})
+	type testcase struct {
+		at     time.Duration
+		result limiter.RateResult
+	}
+	var testcases = []testcase{
+		{at: 0, result: limiter.RateResult{Allowed: true, Limit: 2, Remaining: 1, Reset: time.Minute}},
+		{at: 20 * time.Second, result: limiter.RateResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute}},
+		{at: 30 * time.Second, result: limiter.RateResult{Allowed: false, Limit: 2, Remaining: 0, Reset: 50 * time.Second, RetryAfter: 30 * time.Second}},
+		{at: time.Minute, result: limiter.RateResult{Allowed: true, Limit: 2, Remaining: 0, Reset: time.Minute}},
+		{at: 70 * time.Second, result: limiter.RateResult{Allowed: false, Limit: 2, Remaining: 0, Reset: 50 * time.Second, RetryAfter: 10 * time.Second}},
+	}
+	for i, tc := range testcases {
+		callAt(clock, now.Add(tc.at), func() {
+			if got := sw.Allow("user_01"); got != tc.result {
+				t.Errorf("%d need: %+v, got: %+v\n", i, tc.result, got)
+			}
+		})
+	}
+}
+
+func TestRateLimiter_MaxKeys(t *testing.T) {
+	now := time.Now()
+	clock := x_time.NewFake(now)
+	sw := limiter.NewSlidingWindow(limiter.SlidingWindowConfig{Limit: 1, Window: time.Minute, MaxKeys: 2, Clock: clock})
+	callAt(clock, now, func() {
+		for i := 1; i <= 3; i++ {
+			sw.Allow(strconv.Itoa(i))
+		}
+		// 1 已被淘汰，状态重置
+		if result := sw.Allow("1"); !result.Allowed {
+			t.Errorf("1 need: allowed after eviction\n")
+		}
+		if result := sw.Allow("3"); result.Allowed {
+			t.Errorf("3 need: not allowed\n")
+		}
+	})
+}
+
+func TestRateLimiter_InvalidConfig(t *testing.T) {
+	for name, create := range map[string]func(){
+		"rate":   func() { limiter.NewTokenBucket(limiter.TokenBucketConfig{Rate: 0, Period: time.Second}) },
+		"period": func() { limiter.NewTokenBucket(limiter.TokenBucketConfig{Rate: 1, Period: -time.Second}) },
+		"limit":  func() { limiter.NewSlidingWindow(limiter.SlidingWindowConfig{Limit: -1, Window: time.Minute}) },
+		"window": func() { limiter.NewSlidingWindow(limiter.SlidingWindowConfig{Limit: 1}) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("need panic for invalid %s\n", name)
+				}
+			}()
+			create()
+		}()
+	}
+}
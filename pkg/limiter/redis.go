@@ -0,0 +1,290 @@
+package limiter
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/x_time"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 读取限制状态，达到清除时间的限制视为不存在
+// KEYS[1]: 限制 key，ARGV[1]: 当前时间(毫秒)，返回 {times, limit_at, clear_at}
+var stateScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local v = redis.call('HMGET', KEYS[1], 'times', 'limit_at', 'clear_at')
+local clear_at = tonumber(v[3]) or 0
+if clear_at > 0 and clear_at <= now then
+	return {0, 0, 0}
+end
+return {tonumber(v[1]) or 0, tonumber(v[2]) or 0, clear_at}
+`)
+
+// 增加一次次数并写入限制时间，次数及限制时间在同一个脚本中写入，达到清除时间的限制从 0 开始计数。
+// 限制时间由调用方预先计算，ARGV[5] 开始依次为次数 base+1、base+2... 的限制时长及清除时长，
+// 当前次数不在预先计算的范围内时不做修改，返回 {-1, 当前次数}，由调用方重新计算后重试。
+// check 为 1 且已被限制时不增加次数，返回 {0, 限制解除时间}，否则返回 {1, 增加后的次数}。
+// 未设置清除时长的 key 在最大空闲时间(不短于限制时长)后过期，key 总是有过期时间
+// KEYS[1]: 限制 key，ARGV[1]: 当前时间(毫秒)，ARGV[2]: 最大空闲时间(毫秒)，ARGV[3]: check，ARGV[4]: base
+var addScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local v = redis.call('HMGET', KEYS[1], 'times', 'limit_at', 'clear_at')
+local times = tonumber(v[1]) or 0
+local limit_at = tonumber(v[2]) or 0
+local clear_at = tonumber(v[3]) or 0
+if clear_at > 0 and clear_at <= now then
+	times = 0
+	limit_at = 0
+end
+if ARGV[3] == '1' and limit_at > now then
+	return {0, limit_at}
+end
+local i = times - tonumber(ARGV[4])
+if i < 0 or 2 * i + 6 > #ARGV then
+	return {-1, times}
+end
+local limit_in = tonumber(ARGV[2 * i + 5])
+local clear_in = tonumber(ARGV[2 * i + 6])
+local ttl = tonumber(ARGV[2])
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'times', times + 1)
+if limit_in > 0 then
+	redis.call('HSET', KEYS[1], 'limit_at', now + limit_in)
+	if limit_in > ttl then
+		ttl = limit_in
+	end
+end
+if clear_in > 0 then
+	redis.call('HSET', KEYS[1], 'clear_at', now + clear_in)
+	ttl = clear_in
+end
+redis.call('PEXPIRE', KEYS[1], ttl)
+return {1, times + 1}
+`)
+
+const (
+	addWindow      = 8  // 每次执行 addScript 预先计算的次数个数，并发增加次数时无需重试
+	maxAddAttempts = 16 // 次数超出预先计算范围时的最大尝试次数
+)
+
+// 基于 Redis 的次数限制器，多个实例共享限制状态，重启后限制依然有效。
+// 限制时间由各实例的本地时间计算，各实例需要保持时间同步
+type RedisTimesLimiter struct {
+	client    redis.UniversalClient
+	keyPrefix string
+	provider  LimitTimeProvider
+	clock     x_time.Clock
+	maxIdle   time.Duration
+}
+
+func NewRedisTimesLimiter(client redis.UniversalClient, keyPrefix string, provider LimitTimeProvider) *RedisTimesLimiter {
+	return &RedisTimesLimiter{
+		client:    client,
+		keyPrefix: keyPrefix,
+		provider:  provider,
+		clock:     x_time.Real(),
+		maxIdle:   DefaultMaxIdle,
+	}
+}
+
+// 返回使用 clock 计算限制时间的副本，共享同一 Redis 客户端及 key 前缀
+func (r *RedisTimesLimiter) WithClock(clock x_time.Clock) *RedisTimesLimiter {
+	c := *r
+	c.clock = x_time.Or(clock)
+	return &c
+}
+
+// 返回使用 maxIdle 作为最大空闲时间的副本，provider 未返回清除时长的 key 在最后一次增加次数 maxIdle 后过期，
+// maxIdle <= 0 时 panic
+func (r *RedisTimesLimiter) WithMaxIdle(maxIdle time.Duration) *RedisTimesLimiter {
+	if maxIdle <= 0 {
+		panic("limiter: max idle must be positive, got " + maxIdle.String())
+	}
+	c := *r
+	c.maxIdle = maxIdle
+	return &c
+}
+
+// 解除限制
+func (r *RedisTimesLimiter) RemoveLimit(ctx context.Context, key string) error {
+	return r.client.Del(ctx, r.keyPrefix+key).Err()
+}
+
+// 获得限制剩余时间，已解除的限制返回 0
+func (r *RedisTimesLimiter) CheckLimit(ctx context.Context, key string) (limitIn, clearIn time.Duration, err error) {
+	now := milliseconds(r.clock.Now())
+	_, limitAt, clearAt, err := r.state(ctx, key, now)
+	if err != nil {
+		return 0, 0, err
+	}
+	if limitAt > now {
+		limitIn = time.Duration(limitAt-now) * time.Millisecond
+	}
+	if clearAt > 0 {
+		clearIn = time.Duration(clearAt-now) * time.Millisecond
+	}
+	return limitIn, clearIn, nil
+}
+
+// 增加一次次数，并返回限制剩余时间，达到清除时间的限制将从 0 开始计数。
+// 次数及限制时间在同一个脚本中原子地写入
+func (r *RedisTimesLimiter) AddOneTimes(ctx context.Context, key string) (limitIn, clearIn time.Duration, err error) {
+	_, limitIn, clearIn, err = r.add(ctx, key, false)
+	return limitIn, clearIn, err
+}
+
+// 检查并记录一次次数，检查、记录及写入限制时间在同一个脚本中完成
+func (r *RedisTimesLimiter) CheckAndAdd(ctx context.Context, key string) (allowed bool, limitIn time.Duration, err error) {
+	allowed, limitIn, _, err = r.add(ctx, key, true)
+	return allowed, limitIn, err
+}
+
+// 执行 addScript，provider 在脚本执行前计算，脚本返回的当前次数超出计算范围时以该次数重新计算
+func (r *RedisTimesLimiter) add(ctx context.Context, key string, check bool) (allowed bool, limitIn, clearIn time.Duration, err error) {
+	now := milliseconds(r.clock.Now())
+	keys := []string{r.keyPrefix + key}
+	checkArg := 0
+	if check {
+		checkArg = 1
+	}
+	base := 0
+	for attempt := 0; attempt < maxAddAttempts; attempt++ {
+		args := []interface{}{now, r.maxIdle.Milliseconds(), checkArg, base}
+		limits := make([][2]time.Duration, addWindow)
+		for i := range limits {
+			limits[i][0], limits[i][1] = r.provider(base + i + 1)
+			args = append(args, limits[i][0].Milliseconds(), limits[i][1].Milliseconds())
+		}
+		values, err := int64s(addScript.Run(ctx, r.client, keys, args...).Result())
+		if err != nil {
+			return false, 0, 0, err
+		}
+		if len(values) != 2 {
+			return false, 0, 0, fmt.Errorf("limiter: unexpected script result %v", values)
+		}
+		switch values[0] {
+		case 0:
+			return false, time.Duration(values[1]-now) * time.Millisecond, 0, nil
+		case 1:
+			l := limits[int(values[1])-base-1]
+			return true, l[0], l[1], nil
+		}
+		base = int(values[1])
+	}
+	return false, 0, 0, fmt.Errorf("limiter: too many concurrent updates of key %s", key)
+}
+
+// 获得未达到清除时间的限制
+func (r *RedisTimesLimiter) Get(ctx context.Context, key string) (limit Limit, ok bool, err error) {
+	times, limitAt, clearAt, err := r.state(ctx, key, milliseconds(r.clock.Now()))
+	if err != nil || times == 0 {
+		return Limit{}, false, err
+	}
+	return Limit{Times: times, LimitAt: fromMilliseconds(limitAt), ClearAt: fromMilliseconds(clearAt)}, true, nil
+}
+
+// 按 key 排序列出以 prefix 开头且未达到清除时间的限制，通过 SCAN 遍历 keyPrefix 下的所有 key，仅适用于管理后台等低频查询，
+// keyPrefix 下不能存放其他数据
+func (r *RedisTimesLimiter) List(ctx context.Context, prefix string, offset, limit int) (limits []KeyLimit, total int, err error) {
+	keys, err := r.scan(ctx, escapeGlob(r.keyPrefix+prefix)+"*")
+	if err != nil {
+		return nil, 0, err
+	}
+	for _, key := range keys {
+		key = key[len(r.keyPrefix):]
+		l, ok, err := r.Get(ctx, key)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			limits = append(limits, KeyLimit{Key: key, Limit: l})
+		}
+	}
+	sortKeyLimits(limits)
+	return paginate(limits, offset, limit), len(limits), nil
+}
+
+// 遍历匹配 pattern 的 key，集群模式下遍历所有主节点
+func (r *RedisTimesLimiter) scan(ctx context.Context, pattern string) (keys []string, err error) {
+	var mu sync.Mutex
+	scan := func(ctx context.Context, client redis.UniversalClient) error {
+		iter := client.Scan(ctx, 0, pattern, 100).Iterator()
+		var nodeKeys []string
+		for iter.Next(ctx) {
+			nodeKeys = append(nodeKeys, iter.Val())
+		}
+		if iter.Err() != nil {
+			return iter.Err()
+		}
+		mu.Lock()
+		keys = append(keys, nodeKeys...)
+		mu.Unlock()
+		return nil
+	}
+	if cluster, ok := r.client.(*redis.ClusterClient); ok {
+		err = cluster.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+	} else {
+		err = scan(ctx, r.client)
+	}
+	return keys, err
+}
+
+func (r *RedisTimesLimiter) state(ctx context.Context, key string, now int64) (times int, limitAt, clearAt int64, err error) {
+	values, err := int64s(stateScript.Run(ctx, r.client, []string{r.keyPrefix + key}, now).Result())
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(values) != 3 {
+		return 0, 0, 0, fmt.Errorf("limiter: unexpected script result %v", values)
+	}
+	return int(values[0]), values[1], values[2], nil
+}
+
+// 将脚本返回的数组转换为整数数组
+func int64s(result interface{}, err error) ([]int64, error) {
+	if err != nil {
+		return nil, err
+	}
+	values, ok := result.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("limiter: unexpected script result %v", result)
+	}
+	ints := make([]int64, len(values))
+	for i, value := range values {
+		ints[i], ok = value.(int64)
+		if !ok {
+			return nil, fmt.Errorf("limiter: unexpected script result %v", result)
+		}
+	}
+	return ints, nil
+}
+
+func milliseconds(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// 毫秒时间戳转换为时间，0 表示未设置
+func fromMilliseconds(ms int64) *time.Time {
+	if ms <= 0 {
+		return nil
+	}
+	t := time.Unix(0, ms*int64(time.Millisecond))
+	return &t
+}
+
+// 转义 SCAN 匹配模式中的特殊字符
+func escapeGlob(s string) string {
+	var b strings.Builder
+	for _, c := range s {
+		switch c {
+		case '*', '?', '[', ']', '\\':
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
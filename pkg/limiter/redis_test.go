@@ -0,0 +1,153 @@
+package limiter_test
+
+import (
+	"context"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/pkg/x_time"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRedisTimesLimiter(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	testLimiter(t, func(clock x_time.Clock) limiter.Limiter {
+		return limiter.NewRedisTimesLimiter(client, "limiter_", stepProvider).WithClock(clock)
+	})
+	mr.FlushAll()
+	testInspector(t, func(clock x_time.Clock) interface {
+		limiter.Limiter
+		limiter.Inspector
+	} {
+		return limiter.NewRedisTimesLimiter(client, "limiter_", stepProvider).WithClock(clock)
+	})
+}
+
+func TestRedisTimesLimiter_Concurrent(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	l := limiter.NewRedisTimesLimiter(client, "limiter_", stepProvider)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := l.AddOneTimes(ctx, "user_01")
+			if err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if times := mr.HGet("limiter_user_01", "times"); times != "20" {
+		t.Errorf("times need: 20, got: %s\n", times)
+	}
+	limitIn, _, _ := l.CheckLimit(ctx, "user_01")
+	if limitIn < 14*time.Minute || limitIn > 15*time.Minute {
+		t.Errorf("limitIn need: 15m, got: %v\n", limitIn)
+	}
+}
+
+func TestRedisTimesLimiter_MaxIdle(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	// 未达到限制的次数不返回清除时长
+	provider := func(times int) (limitIn, clearIn time.Duration) {
+		if times < 3 {
+			return 0, 0
+		}
+		return time.Minute, 0
+	}
+	l := limiter.NewRedisTimesLimiter(client, "limiter_", provider).WithMaxIdle(time.Hour)
+	for _, key := range []string{"user_01", "user_02"} {
+		if _, _, err = l.AddOneTimes(ctx, key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err = l.CheckAndAdd(ctx, "user_01"); err != nil {
+		t.Fatal(err)
+	}
+	if ttl := mr.TTL("limiter_user_01"); ttl != time.Hour {
+		t.Errorf("ttl need: 1h, got: %v\n", ttl)
+	}
+	mr.FastForward(time.Hour)
+	if mr.Exists("limiter_user_01") || mr.Exists("limiter_user_02") {
+		t.Error("need idle keys expired")
+	}
+	// 限制时间在增加次数之前计算，计算中断时不会留下没有限制时间的次数
+	crash := limiter.NewRedisTimesLimiter(client, "limiter_", func(times int) (limitIn, clearIn time.Duration) {
+		panic("crash")
+	}).WithMaxIdle(time.Hour)
+	func() {
+		defer func() { recover() }()
+		_, _, _ = crash.AddOneTimes(ctx, "user_03")
+	}()
+	if mr.Exists("limiter_user_03") {
+		t.Error("need: no key written by crashed provider")
+	}
+}
+
+func TestRedisTimesLimiter_ConcurrentCheckAndAdd(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	ctx := context.Background()
+	// 第 3 次起锁定，并发请求中只有 3 个通过检查
+	l := limiter.NewRedisTimesLimiter(client, "limiter_", limiter.Linear(2, time.Minute, time.Hour)).WithClock(x_time.NewFake(time.Now()))
+	var allowed int
+	var mu sync.Mutex
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ok, _, err := l.CheckAndAdd(ctx, "user_01")
+			if err != nil {
+				t.Error(err)
+			}
+			if ok {
+				mu.Lock()
+				allowed++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 3 {
+		t.Errorf("allowed need: 3, got: %d\n", allowed)
+	}
+	// 超出预先计算范围的次数重新计算后写入
+	for i := 0; i < 20; i++ {
+		if _, _, err = l.AddOneTimes(ctx, "user_02"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	limitIn, _, err := l.CheckLimit(ctx, "user_02")
+	if err != nil || limitIn != 18*time.Minute {
+		t.Errorf("limitIn need: 18m, got: %v, %v\n", limitIn, err)
+	}
+}
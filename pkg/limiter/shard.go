@@ -0,0 +1,231 @@
+package limiter
+
+import (
+	"container/heap"
+	"container/list"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 限制器分段，每个分段独立上锁，key 按哈希值分配到分段
+type shard struct {
+	limits  map[string]*entry
+	lru     *list.List // 链表头部为最近增加次数的 key
+	clears  clearHeap  // 按清除时间排序的 key，未设置清除时间的 key 不在其中
+	idles   idleHeap   // 按空闲超时时间排序的 key，设置了清除时间的 key 不在其中
+	keys    *int64     // 所有分段的 key 数量，由各分段原子地增减
+	maxIdle time.Duration
+	evicted uint64
+	swept   uint64
+	mu      sync.Mutex
+}
+
+func newShard(keys *int64, maxIdle time.Duration) *shard {
+	return &shard{
+		limits:  map[string]*entry{},
+		lru:     list.New(),
+		keys:    keys,
+		maxIdle: maxIdle,
+	}
+}
+
+type entry struct {
+	Limit
+	key       string
+	addedAt   time.Time // 最后一次增加次数的时间，与 lru 中的顺序一致
+	idleAt    time.Time // 空闲超时时间，即最后一次增加次数 maxIdle 后且不在限制中，仅对未设置清除时间的 key 有效
+	el        *list.Element
+	index     int // 在 clears 中的下标，-1 表示不在 clears 中
+	idleIndex int // 在 idles 中的下标，-1 表示不在 idles 中
+}
+
+// 添加新的限制，超出 MaxKeys 时由调用方在释放锁后淘汰，需要上锁
+func (s *shard) insert(key string, limit Limit, now time.Time) *entry {
+	if e := s.limits[key]; e != nil {
+		s.remove(e)
+	}
+	e := &entry{Limit: limit, key: key, addedAt: now, index: -1, idleIndex: -1}
+	e.el = s.lru.PushFront(e)
+	s.limits[key] = e
+	atomic.AddInt64(s.keys, 1)
+	s.update(e)
+	return e
+}
+
+// 增加一次次数，需要上锁
+func (s *shard) addOneTimes(key string, now time.Time, provider LimitTimeProvider) (limitIn, clearIn time.Duration) {
+	e := s.limits[key]
+	if e == nil || e.cleared(now) {
+		// 回收 3 个已达到清除时间的限制，相当于垃圾清理器，每次只清理少量垃圾，不会因为大量清理垃圾而导致程序卡顿
+		s.removeExpired(now, 3)
+		e = s.insert(key, Limit{}, now)
+	} else {
+		e.addedAt = now
+		s.lru.MoveToFront(e.el)
+	}
+	e.Times++
+	limitIn, clearIn = provider(e.Times)
+	if limitIn > 0 {
+		limitAt := now.Add(limitIn)
+		e.LimitAt = &limitAt
+	} else {
+		e.LimitAt = nil
+	}
+	if clearIn > 0 {
+		clearAt := now.Add(clearIn)
+		e.ClearAt = &clearAt
+	} else {
+		e.ClearAt = nil
+	}
+	s.update(e)
+	return
+}
+
+// 限制或最后一次增加次数的时间变化后更新 clears 及 idles，需要上锁
+func (s *shard) update(e *entry) {
+	switch {
+	case e.ClearAt == nil && e.index >= 0:
+		heap.Remove(&s.clears, e.index)
+	case e.ClearAt != nil && e.index < 0:
+		heap.Push(&s.clears, e)
+	case e.ClearAt != nil:
+		heap.Fix(&s.clears, e.index)
+	}
+	if e.ClearAt != nil {
+		if e.idleIndex >= 0 {
+			heap.Remove(&s.idles, e.idleIndex)
+		}
+		return
+	}
+	e.idleAt = e.addedAt.Add(s.maxIdle)
+	if e.LimitAt != nil && e.LimitAt.After(e.idleAt) {
+		e.idleAt = *e.LimitAt
+	}
+	if e.idleIndex < 0 {
+		heap.Push(&s.idles, e)
+	} else {
+		heap.Fix(&s.idles, e.idleIndex)
+	}
+}
+
+// 删除限制，需要上锁
+func (s *shard) remove(e *entry) {
+	if e.index >= 0 {
+		heap.Remove(&s.clears, e.index)
+	}
+	if e.idleIndex >= 0 {
+		heap.Remove(&s.idles, e.idleIndex)
+	}
+	s.lru.Remove(e.el)
+	delete(s.limits, e.key)
+	atomic.AddInt64(s.keys, -1)
+}
+
+// 按淘汰策略删除一个 key，不删除 skip(即刚增加次数的 key)，没有可删除的 key 时返回 false，需要上锁
+func (s *shard) evictOne(eviction EvictionPolicy, skip string) bool {
+	var e *entry
+	if eviction == EvictSoonestCleared && len(s.clears) > 0 && s.clears[0].key != skip {
+		e = s.clears[0]
+	}
+	for el := s.lru.Back(); e == nil && el != nil; el = el.Prev() {
+		if el.Value.(*entry).key != skip {
+			e = el.Value.(*entry)
+		}
+	}
+	if e == nil {
+		return false
+	}
+	s.remove(e)
+	s.evicted++
+	return true
+}
+
+// 回收最多 n 个已达到清除时间或空闲超时的限制，返回回收数量，需要上锁
+func (s *shard) removeExpired(now time.Time, n int) int {
+	removed := 0
+	for removed < n && len(s.clears) > 0 && s.clears[0].cleared(now) {
+		s.remove(s.clears[0])
+		removed++
+	}
+	for removed < n && len(s.idles) > 0 && !now.Before(s.idles[0].idleAt) {
+		s.remove(s.idles[0])
+		removed++
+	}
+	s.swept += uint64(removed)
+	return removed
+}
+
+// 按清除时间排序的最小堆
+type clearHeap []*entry
+
+func (h clearHeap) Len() int {
+	return len(h)
+}
+
+func (h clearHeap) Less(i, j int) bool {
+	return h[i].ClearAt.Before(*h[j].ClearAt)
+}
+
+func (h clearHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *clearHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *clearHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.index = -1
+	*h = old[:len(old)-1]
+	return e
+}
+
+// 按空闲超时时间排序的最小堆
+type idleHeap []*entry
+
+func (h idleHeap) Len() int {
+	return len(h)
+}
+
+func (h idleHeap) Less(i, j int) bool {
+	return h[i].idleAt.Before(h[j].idleAt)
+}
+
+func (h idleHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].idleIndex = i
+	h[j].idleIndex = j
+}
+
+func (h *idleHeap) Push(x interface{}) {
+	e := x.(*entry)
+	e.idleIndex = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *idleHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	e.idleIndex = -1
+	*h = old[:len(old)-1]
+	return e
+}
+
+// FNV-1a 哈希，避免 hash.Hash 的内存分配
+func fnv32(key string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return h
+}
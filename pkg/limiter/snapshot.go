@@ -0,0 +1,100 @@
+package limiter
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// 创建次数限制器，并从 opts.SnapshotFile 恢复限制，快照文件不存在时返回空的限制器
+func LoadTimesLimiter(provider LimitTimeProvider, opts TimesLimiterOptions) (*TimesLimiter, error) {
+	ts := NewTimesLimiterWithOptions(provider, opts)
+	if opts.SnapshotFile != "" {
+		err := ts.LoadFile(opts.SnapshotFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ts, nil
+}
+
+// 将所有限制以 JSON 格式写入 w，各分段内按最久未增加次数到最近增加次数排序，恢复后 LRU 顺序不变
+func (ts *TimesLimiter) Snapshot(w io.Writer) error {
+	var entries []KeyLimit
+	for _, s := range ts.shards {
+		s.mu.Lock()
+		for el := s.lru.Back(); el != nil; el = el.Prev() {
+			e := el.Value.(*entry)
+			entries = append(entries, KeyLimit{Key: e.key, Limit: e.Limit})
+		}
+		s.mu.Unlock()
+	}
+	if entries == nil {
+		entries = []KeyLimit{}
+	}
+	return json.NewEncoder(w).Encode(entries)
+}
+
+// 从 r 恢复限制，已达到清除时间的限制将被丢弃，同名 key 将被覆盖
+func (ts *TimesLimiter) Restore(r io.Reader) error {
+	var entries []KeyLimit
+	err := json.NewDecoder(r).Decode(&entries)
+	if err != nil {
+		return err
+	}
+	now := ts.clock.Now()
+	for _, kl := range entries {
+		if kl.cleared(now) {
+			continue
+		}
+		s := ts.shard(kl.Key)
+		s.mu.Lock()
+		// 快照中不保存最后一次增加次数的时间，空闲时间从恢复时开始计算
+		s.insert(kl.Key, kl.Limit, now)
+		s.mu.Unlock()
+		ts.evict(kl.Key)
+	}
+	return nil
+}
+
+// 将快照保存到文件，先写入临时文件再重命名，避免进程中断导致快照文件损坏
+func (ts *TimesLimiter) SaveFile(filename string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = ts.Snapshot(tmp)
+	if err != nil {
+		tmp.Close()
+		return err
+	}
+	err = tmp.Close()
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filename)
+}
+
+// 从文件恢复限制，文件不存在时不做任何操作
+func (ts *TimesLimiter) LoadFile(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	return ts.Restore(f)
+}
+
+// 保存快照到 opts.SnapshotFile，错误交由 opts.OnSnapshotError 处理
+func (ts *TimesLimiter) saveSnapshot() {
+	err := ts.SaveFile(ts.opts.SnapshotFile)
+	if err != nil && ts.opts.OnSnapshotError != nil {
+		ts.opts.OnSnapshotError(err)
+	}
+}
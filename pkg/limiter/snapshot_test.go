@@ -0,0 +1,108 @@
+package limiter_test
+
+import (
+	"bytes"
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/pkg/x_time"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTimesLimiter_Restore(t *testing.T) {
+	now := time.Now()
+	clock := x_time.NewFake(now)
+	buf := &bytes.Buffer{}
+	ts := limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{Clock: clock})
+	callAt(clock, now, func() {
+		for i := 0; i < 6; i++ {
+			ts.AddOneTimes("expired")
+		}
+		for i := 0; i < 7; i++ {
+			ts.AddOneTimes("limited")
+		}
+	})
+	callAt(clock, now.Add(90*time.Second), func() {
+		ts.AddOneTimes("counted")
+		err := ts.Snapshot(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	// expired 于 2 分钟后清除，counted 于 3.5 分钟后清除，limited 于 4 分钟后清除
+	callAt(clock, now.Add(3*time.Minute), func() {
+		ts := limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{Shards: 1, MaxKeys: 1, Clock: clock})
+		err := ts.Restore(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 超出 MaxKeys 时按快照中的 LRU 顺序淘汰
+		if stats := ts.Stats(); stats.Keys != 1 || stats.Evicted != 1 {
+			t.Errorf("need: {1 0 1 0}, got: %v\n", stats)
+		}
+		ts = limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{Clock: clock})
+		_ = ts.Restore(buf)
+		if limitIn, clearIn := ts.CheckLimit("expired"); limitIn != 0 || clearIn != 0 {
+			t.Errorf("expired need: 0 0, got: %v %v\n", limitIn, clearIn)
+		}
+		if limitIn, clearIn := ts.CheckLimit("limited"); limitIn != 0 || clearIn != time.Minute {
+			t.Errorf("limited need: 0 %v, got: %v %v\n", time.Minute, limitIn, clearIn)
+		}
+		// 次数从快照中累加
+		if limitIn, _ := ts.AddOneTimes("limited"); limitIn != 3*time.Minute {
+			t.Errorf("limited need: %v, got: %v\n", 3*time.Minute, limitIn)
+		}
+		for i := 0; i < 5; i++ {
+			ts.AddOneTimes("counted")
+		}
+		if limitIn, _ := ts.CheckLimit("counted"); limitIn != time.Minute {
+			t.Errorf("counted need: %v, got: %v\n", time.Minute, limitIn)
+		}
+	})
+	buf.Reset()
+	buf.WriteString("not json")
+	if err := limiter.NewTimesLimiter(stepProvider).Restore(buf); err == nil {
+		t.Error("need error, got: nil")
+	}
+}
+
+func TestLoadTimesLimiter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "limiter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	opts := limiter.TimesLimiterOptions{
+		SnapshotFile:     filepath.Join(dir, "limits.json"),
+		SnapshotInterval: time.Hour,
+		OnSnapshotError: func(err error) {
+			t.Error(err)
+		},
+	}
+	// 快照文件不存在
+	ts, err := limiter.LoadTimesLimiter(stepProvider, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ts.Start(time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		ts.AddOneTimes("key")
+	}
+	// 停止时保存快照
+	ts.Stop()
+	ts, err = limiter.LoadTimesLimiter(stepProvider, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limitIn, _ := ts.CheckLimit("key"); limitIn <= 0 {
+		t.Errorf("need: > 0, got: %v\n", limitIn)
+	}
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("files need: 1, got: %d\n", len(files))
+	}
+}
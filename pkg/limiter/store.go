@@ -0,0 +1,69 @@
+package limiter
+
+import (
+	"container/list"
+	"time"
+)
+
+// 按 key 保存限制状态，速率限制器共用的淘汰策略：
+// 1. key 数量超过 maxKeys 时淘汰最久未使用的 key
+// 2. 空闲超过 idle 的 key 与初始状态相同，每次访问时从最久未使用的一端顺带清理
+// 所有方法都需要调用方上锁
+type keyStore struct {
+	maxKeys int
+	idle    time.Duration
+	entries map[string]*list.Element
+	lru     *list.List // 链表头部为最近使用的 key
+}
+
+type storeEntry struct {
+	key      string
+	state    interface{}
+	accessAt time.Time
+}
+
+// 每次访问时最多清理的空闲 key 数量，避免一次清理过多导致请求卡顿
+const maxIdleRemoval = 3
+
+func newKeyStore(maxKeys int, idle time.Duration) *keyStore {
+	return &keyStore{
+		maxKeys: maxKeys,
+		idle:    idle,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// 获得 key 对应的状态，不存在则通过 newState 创建
+func (s *keyStore) get(key string, now time.Time, newState func() interface{}) interface{} {
+	s.removeIdle(now)
+	el, ok := s.entries[key]
+	if ok {
+		s.lru.MoveToFront(el)
+	} else {
+		el = s.lru.PushFront(&storeEntry{key: key, state: newState()})
+		s.entries[key] = el
+		if s.maxKeys > 0 && s.lru.Len() > s.maxKeys {
+			s.remove(s.lru.Back())
+		}
+	}
+	entry := el.Value.(*storeEntry)
+	entry.accessAt = now
+	return entry.state
+}
+
+func (s *keyStore) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.entries, el.Value.(*storeEntry).key)
+}
+
+// 从最久未使用的一端清理空闲 key
+func (s *keyStore) removeIdle(now time.Time) {
+	for i := 0; i < maxIdleRemoval; i++ {
+		el := s.lru.Back()
+		if el == nil || now.Sub(el.Value.(*storeEntry).accessAt) < s.idle {
+			return
+		}
+		s.remove(el)
+	}
+}
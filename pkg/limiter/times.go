@@ -1,26 +1,82 @@
 package limiter
 
 import (
+	"fmt"
 	"github.com/morgine/moon/pkg/x_time"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // 根据限制次数获取限制时间及限制解除时间
 type LimitTimeProvider func(times int) (limitIn, clearIn time.Duration)
 
+// key 数量超过上限时的淘汰策略
+type EvictionPolicy int
+
+const (
+	EvictLeastRecentlyUsed EvictionPolicy = iota // 淘汰最久未增加次数的 key
+	EvictSoonestCleared                          // 淘汰最早达到清除时间的 key，没有设置清除时间的 key 时淘汰最久未增加次数的 key
+)
+
+// 默认分段数
+const DefaultShards = 16
+
+// 未设置清除时间的 key 的默认最大空闲时间
+const DefaultMaxIdle = 24 * time.Hour
+
+type TimesLimiterOptions struct {
+	// 分段数，0 表示使用 DefaultShards。key 按哈希值分配到各分段，各分段独立上锁以减少并发竞争。
+	// 所有分段的 key 数量之和不超过 MaxKeys，超出时从新增 key 所在的分段开始依次在分段内淘汰，
+	// 需要严格按全局顺序淘汰时设置为 1
+	Shards   int
+	MaxKeys  int            // 最大 key 数量，0 表示不限制
+	Eviction EvictionPolicy // 超出 MaxKeys 时的淘汰策略
+	Clock    x_time.Clock   // 时钟，用于计算限制时间及后台清理，为空则使用系统时间
+	// 未设置清除时间的 key 在最后一次增加次数 MaxIdle 后(且不在限制中)被回收，避免此类 key 无限增长，0 表示使用 DefaultMaxIdle
+	MaxIdle time.Duration
+
+	// 快照文件，设置后 LoadTimesLimiter 将从该文件恢复限制，Start 启动后每隔 SnapshotInterval 保存一次快照，
+	// Stop 时保存最后一次快照，避免重启后所有封禁失效
+	SnapshotFile     string
+	SnapshotInterval time.Duration
+	OnSnapshotError  func(err error) // 后台保存快照失败时回调，为 nil 则忽略错误
+}
+
 // 次数限制器，可用于 IP 封禁或用户账户登陆封禁
 type TimesLimiter struct {
-	limits   map[string]*Limit
+	keys     int64 // 所有分段的 key 数量，原子操作，位于结构体开头以保证 32 位平台上 64 位对齐
+	shards   []*shard
 	provider LimitTimeProvider
-	mu       sync.Mutex
+	opts     TimesLimiterOptions
+	clock    x_time.Clock
+	stop     chan struct{}
+	done     chan struct{}
+	mu       sync.Mutex // 仅用于启动及停止后台清理
 }
 
 func NewTimesLimiter(provider LimitTimeProvider) *TimesLimiter {
-	return &TimesLimiter{
-		limits:   map[string]*Limit{},
+	return NewTimesLimiterWithOptions(provider, TimesLimiterOptions{})
+}
+
+func NewTimesLimiterWithOptions(provider LimitTimeProvider, opts TimesLimiterOptions) *TimesLimiter {
+	if opts.Shards <= 0 {
+		opts.Shards = DefaultShards
+	}
+	if opts.MaxIdle <= 0 {
+		opts.MaxIdle = DefaultMaxIdle
+	}
+	ts := &TimesLimiter{
+		shards:   make([]*shard, opts.Shards),
 		provider: provider,
+		opts:     opts,
+		clock:    x_time.Or(opts.Clock),
+	}
+	for i := range ts.shards {
+		ts.shards[i] = newShard(&ts.keys, opts.MaxIdle)
 	}
+	return ts
 }
 
 type Limit struct {
@@ -29,72 +85,221 @@ type Limit struct {
 	ClearAt *time.Time // 限制清除时间
 }
 
+// 是否已达到清除时间，未设置清除时间的限制不会被清除
+func (l *Limit) cleared(now time.Time) bool {
+	return l.ClearAt != nil && !now.Before(*l.ClearAt)
+}
+
+// 带 key 的限制，用于快照及查询
+type KeyLimit struct {
+	Key string
+	Limit
+}
+
+// 限制器统计数据
+type TimesLimiterStats struct {
+	Keys    int    // 当前 key 数量(包含已达到清除时间但未被回收的 key)
+	Limited int    // 当前处于限制中的 key 数量
+	Evicted uint64 // 因超出 MaxKeys 被淘汰的 key 数量
+	Swept   uint64 // 达到清除时间或空闲超过 MaxIdle 后被回收的 key 数量
+}
+
+// 获得 key 所在的分段
+func (ts *TimesLimiter) shard(key string) *shard {
+	return ts.shards[ts.shardIndex(key)]
+}
+
+func (ts *TimesLimiter) shardIndex(key string) int {
+	return int(fnv32(key) % uint32(len(ts.shards)))
+}
+
+// key 数量超过 MaxKeys 时按淘汰策略淘汰，从 key 所在的分段开始依次在各分段内淘汰，不淘汰 key 本身。
+// 调用时不能持有分段锁，每次只持有一个分段的锁，避免分段之间互相等待
+func (ts *TimesLimiter) evict(key string) {
+	max := int64(ts.opts.MaxKeys)
+	if max <= 0 {
+		return
+	}
+	start := ts.shardIndex(key)
+	for i := 0; i < len(ts.shards) && atomic.LoadInt64(&ts.keys) > max; i++ {
+		s := ts.shards[(start+i)%len(ts.shards)]
+		s.mu.Lock()
+		for atomic.LoadInt64(&ts.keys) > max && s.evictOne(ts.opts.Eviction, key) {
+		}
+		s.mu.Unlock()
+	}
+}
+
 // 解除限制
 func (ts *TimesLimiter) RemoveLimit(key string) {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
-	delete(ts.limits, key)
+	s := ts.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e := s.limits[key]; e != nil {
+		s.remove(e)
+	}
 }
 
-// 获得限制剩余时间
+// 获得限制剩余时间，已解除的限制返回 0
 func (ts *TimesLimiter) CheckLimit(key string) (limitIn, clearIn time.Duration) {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
-	l := ts.limits[key]
-	if l != nil {
-		now := x_time.Now()
-		if l.LimitAt != nil {
-			limitIn = l.LimitAt.Sub(now)
+	s := ts.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.limits[key]
+	now := ts.clock.Now()
+	if e != nil && !e.cleared(now) {
+		if e.LimitAt != nil && e.LimitAt.After(now) {
+			limitIn = e.LimitAt.Sub(now)
 		}
-		if l.ClearAt != nil {
-			clearIn = l.ClearAt.Sub(now)
+		if e.ClearAt != nil {
+			clearIn = e.ClearAt.Sub(now)
 		}
 	}
 	return
 }
 
-// 增加一次次数，并返回限制剩余时间
+// 检查并记录一次次数，已被限制则不记录并返回剩余限制时间，否则记录一次次数并返回记录后的限制时间
+func (ts *TimesLimiter) CheckAndAdd(key string) (allowed bool, limitIn time.Duration) {
+	s := ts.shard(key)
+	s.mu.Lock()
+	now := ts.clock.Now()
+	e := s.limits[key]
+	if e != nil && !e.cleared(now) && e.LimitAt != nil && e.LimitAt.After(now) {
+		limitIn = e.LimitAt.Sub(now)
+		s.mu.Unlock()
+		return false, limitIn
+	}
+	limitIn, _ = s.addOneTimes(key, now, ts.provider)
+	s.mu.Unlock()
+	ts.evict(key)
+	return true, limitIn
+}
+
+// 增加一次次数，并返回限制剩余时间，达到清除时间的限制将从 0 开始计数
 func (ts *TimesLimiter) AddOneTimes(key string) (limitIn, clearIn time.Duration) {
-	ts.mu.Lock()
-	defer ts.mu.Unlock()
-	l := ts.limits[key]
-	now := x_time.Now()
-	if l == nil || l.ClearAt == nil || l.ClearAt.Before(now) {
-		if l == nil {
-			l = &Limit{}
-			ts.limits[key] = l
+	s := ts.shard(key)
+	s.mu.Lock()
+	limitIn, clearIn = s.addOneTimes(key, ts.clock.Now(), ts.provider)
+	s.mu.Unlock()
+	ts.evict(key)
+	return limitIn, clearIn
+}
+
+// 获得未达到清除时间的限制
+func (ts *TimesLimiter) Get(key string) (limit Limit, ok bool) {
+	s := ts.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e := s.limits[key]
+	if e == nil || e.cleared(ts.clock.Now()) {
+		return Limit{}, false
+	}
+	return e.Limit, true
+}
+
+// 按 key 排序列出以 prefix 开头且未达到清除时间的限制，跳过 offset 条后最多返回 limit 条，limit <= 0 表示不限制条数，
+// total 为符合条件的总条数
+func (ts *TimesLimiter) List(prefix string, offset, limit int) (limits []KeyLimit, total int) {
+	now := ts.clock.Now()
+	for _, s := range ts.shards {
+		s.mu.Lock()
+		for key, e := range s.limits {
+			if strings.HasPrefix(key, prefix) && !e.cleared(now) {
+				limits = append(limits, KeyLimit{Key: key, Limit: e.Limit})
+			}
 		}
-		// 随机查询 3 个限制是否过期，相当于垃圾清理器，不同于全局垃圾清理，这种策略只能清理 2/3 的垃圾，
-		// 但不会因为大量清理垃圾而导致程序卡顿
-		ts.removeExpired(3)
-	}
-	l.Times++
-	limitIn, clearIn = ts.provider(l.Times)
-	if limitIn > 0 {
-		limitAt := now.Add(limitIn)
-		l.LimitAt = &limitAt
-	} else {
-		l.LimitAt = nil
-	}
-	if clearIn > 0 {
-		clearAt := now.Add(clearIn)
-		l.ClearAt = &clearAt
-	} else {
-		l.LimitAt = nil
+		s.mu.Unlock()
 	}
-	return
+	sortKeyLimits(limits)
+	return paginate(limits, offset, limit), len(limits)
 }
 
-// 随机查询 n 个限制是否达到清除时间, 达到清除时间则清除该限制，需要上锁
-func (ts *TimesLimiter) removeExpired(random int) {
-	now := x_time.Now()
-	for key, limit := range ts.limits {
-		if limit.ClearAt != nil && limit.ClearAt.Before(now) {
-			delete(ts.limits, key)
+// 获得统计数据，各分段依次统计，并发修改时结果不是同一时刻的快照
+func (ts *TimesLimiter) Stats() TimesLimiterStats {
+	now := ts.clock.Now()
+	stats := TimesLimiterStats{}
+	for _, s := range ts.shards {
+		s.mu.Lock()
+		stats.Keys += len(s.limits)
+		stats.Evicted += s.evicted
+		stats.Swept += s.swept
+		for _, e := range s.limits {
+			if !e.cleared(now) && e.LimitAt != nil && e.LimitAt.After(now) {
+				stats.Limited++
+			}
 		}
-		random--
-		if random <= 0 {
+		s.mu.Unlock()
+	}
+	return stats
+}
+
+// 每批回收的限制数量，每批之间释放锁，避免长时间阻塞请求
+const sweepBatch = 1000
+
+// 启动后台清理，每隔 interval 回收所有已达到清除时间或空闲超时的限制，设置了快照文件时同时定期保存快照，
+// interval <= 0 时返回错误，重复调用无效
+func (ts *TimesLimiter) Start(interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("limiter: sweep interval must be positive, got %v", interval)
+	}
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	if ts.stop != nil {
+		return nil
+	}
+	ts.stop = make(chan struct{})
+	ts.done = make(chan struct{})
+	go ts.sweep(interval, ts.stop, ts.done)
+	return nil
+}
+
+// 停止后台清理，设置了快照文件时等待保存最后一次快照后返回
+func (ts *TimesLimiter) Stop() {
+	ts.mu.Lock()
+	stop, done := ts.stop, ts.done
+	ts.stop, ts.done = nil, nil
+	ts.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+func (ts *TimesLimiter) sweep(interval time.Duration, stop, done chan struct{}) {
+	defer close(done)
+	ticker := ts.clock.NewTicker(interval)
+	defer ticker.Stop()
+	var snapshot <-chan time.Time
+	if ts.opts.SnapshotFile != "" && ts.opts.SnapshotInterval > 0 {
+		snapshotTicker := ts.clock.NewTicker(ts.opts.SnapshotInterval)
+		defer snapshotTicker.Stop()
+		snapshot = snapshotTicker.C()
+	}
+	for {
+		select {
+		case <-ticker.C():
+			ts.sweepAll()
+		case <-snapshot:
+			ts.saveSnapshot()
+		case <-stop:
+			if ts.opts.SnapshotFile != "" {
+				ts.saveSnapshot()
+			}
 			return
 		}
 	}
 }
+
+// 回收所有分段中已达到清除时间或空闲超时的限制
+func (ts *TimesLimiter) sweepAll() {
+	for _, s := range ts.shards {
+		for ts.sweepShard(s) == sweepBatch {
+		}
+	}
+}
+
+func (ts *TimesLimiter) sweepShard(s *shard) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.removeExpired(ts.clock.Now(), sweepBatch)
+}
@@ -3,6 +3,8 @@ package limiter_test
 import (
 	"github.com/morgine/moon/pkg/limiter"
 	"github.com/morgine/moon/pkg/x_time"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 )
@@ -29,39 +31,225 @@ func TestNewTimesLimiter(t *testing.T) {
 		{times: 8, limitIn: limitBase * 3, clearIn: clearBase * 3},
 	}
 
-	callAt(time.Now(), func() {
-		timesLimiter := limiter.NewTimesLimiter(func(times int) (limitIn, clearIn time.Duration) {
-			if 0 < times && times < n {
-				// 1-n 次不设置时间
-				return 0, 0
-			} else {
-				limitIn = time.Duration(times-n) * limitBase
-				clearIn = time.Duration(times-n) * clearBase
-				return
-			}
+	clock := x_time.NewFake(time.Now())
+	timesLimiter := limiter.NewTimesLimiterWithOptions(func(times int) (limitIn, clearIn time.Duration) {
+		if 0 < times && times < n {
+			// 1-n 次不设置时间
+			return 0, 0
+		} else {
+			limitIn = time.Duration(times-n) * limitBase
+			clearIn = time.Duration(times-n) * clearBase
+			return
+		}
+	}, limiter.TimesLimiterOptions{Clock: clock})
+	key := "user_01"
+	for _, tc := range testcases {
+		timesLimiter.RemoveLimit(key)
+		for i := 0; i < tc.times; i++ {
+			timesLimiter.AddOneTimes(key)
+		}
+		limitIn, clearIn := timesLimiter.CheckLimit(key)
+		if limitIn != tc.limitIn {
+			t.Errorf("%d need: %v, got: %v\n", tc.times, tc.limitIn, limitIn)
+		}
+		if clearIn != tc.clearIn {
+			t.Errorf("%d need: %v, got: %v\n", tc.times, tc.clearIn, clearIn)
+		}
+	}
+}
+
+// 将时钟设置为 t 后执行 call
+func callAt(clock *x_time.Fake, t time.Time, call func()) {
+	clock.Set(t)
+	call()
+}
+
+// 5 次以上限制时间逐步递增
+var stepProvider = limiter.Linear(5, time.Minute, 2*time.Minute)
+
+func TestMemoryLimiter(t *testing.T) {
+	testLimiter(t, func(clock x_time.Clock) limiter.Limiter {
+		return limiter.NewMemoryLimiter(limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{Clock: clock}))
+	})
+	testInspector(t, func(clock x_time.Clock) interface {
+		limiter.Limiter
+		limiter.Inspector
+	} {
+		return limiter.NewMemoryLimiter(limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{Clock: clock})).(interface {
+			limiter.Limiter
+			limiter.Inspector
 		})
-		key := "user_01"
-		for _, tc := range testcases {
-			timesLimiter.RemoveLimit(key)
-			for i := 0; i < tc.times; i++ {
-				timesLimiter.AddOneTimes(key)
-			}
-			limitIn, clearIn := timesLimiter.CheckLimit(key)
-			if limitIn != tc.limitIn {
-				t.Errorf("%d need: %v, got: %v\n", tc.times, tc.limitIn, limitIn)
-			}
-			if clearIn != tc.clearIn {
-				t.Errorf("%d need: %v, got: %v\n", tc.times, tc.clearIn, clearIn)
+	})
+}
+
+func TestTimesLimiter_MaxKeys(t *testing.T) {
+	// 每次均限制，清除时间随 key 的次数递增
+	provider := func(times int) (limitIn, clearIn time.Duration) {
+		return time.Minute, time.Duration(times) * time.Minute
+	}
+	clock := x_time.NewFake(time.Now())
+	lru := limiter.NewTimesLimiterWithOptions(provider, limiter.TimesLimiterOptions{Shards: 1, MaxKeys: 2, Clock: clock})
+	soonest := limiter.NewTimesLimiterWithOptions(provider, limiter.TimesLimiterOptions{Shards: 1, MaxKeys: 2, Eviction: limiter.EvictSoonestCleared, Clock: clock})
+	for _, ts := range []*limiter.TimesLimiter{lru, soonest} {
+		ts.AddOneTimes("a")
+		ts.AddOneTimes("a")
+		ts.AddOneTimes("b")
+		ts.AddOneTimes("a")
+		ts.AddOneTimes("c")
+	}
+	// a 最近增加过次数，LRU 淘汰 b
+	// b 清除时间最早，同样被淘汰
+	for _, ts := range []*limiter.TimesLimiter{lru, soonest} {
+		if limitIn, _ := ts.CheckLimit("b"); limitIn != 0 {
+			t.Errorf("b need: 0, got: %v\n", limitIn)
+		}
+	}
+	// 此时 a 清除时间晚于 c，但 c 最近增加过次数
+	lru.AddOneTimes("d")
+	soonest.AddOneTimes("d")
+	if limitIn, _ := lru.CheckLimit("a"); limitIn != 0 {
+		t.Errorf("lru a need: 0, got: %v\n", limitIn)
+	}
+	if limitIn, _ := soonest.CheckLimit("c"); limitIn != 0 {
+		t.Errorf("soonest c need: 0, got: %v\n", limitIn)
+	}
+	if limitIn, _ := soonest.CheckLimit("a"); limitIn != time.Minute {
+		t.Errorf("soonest a need: %v, got: %v\n", time.Minute, limitIn)
+	}
+	for _, ts := range []*limiter.TimesLimiter{lru, soonest} {
+		stats := ts.Stats()
+		if stats.Keys != 2 || stats.Limited != 2 || stats.Evicted != 2 {
+			t.Errorf("need: {2 2 2 0}, got: %v\n", stats)
+		}
+	}
+}
+
+func TestTimesLimiter_Sweep(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	ts := limiter.NewTimesLimiterWithOptions(func(times int) (limitIn, clearIn time.Duration) {
+		return 0, time.Minute
+	}, limiter.TimesLimiterOptions{Clock: clock})
+	// 未设置清除时间的 key 空闲 3 分钟后回收，处于限制中的 key 除外
+	idle := limiter.NewTimesLimiterWithOptions(func(times int) (limitIn, clearIn time.Duration) {
+		if times > 1 {
+			return time.Hour, 0
+		}
+		return 0, 0
+	}, limiter.TimesLimiterOptions{Clock: clock, MaxIdle: 3 * time.Minute})
+	// 最早增加次数但处于限制中的 key 不影响回收之后空闲超时的 key
+	idle.AddOneTimes("limited")
+	idle.AddOneTimes("limited")
+	for i := 0; i < 2500; i++ {
+		ts.AddOneTimes(strconv.Itoa(i))
+		idle.AddOneTimes(strconv.Itoa(i))
+	}
+	if err := ts.Start(0); err == nil {
+		t.Error("need error for non-positive interval, got: nil")
+	}
+	for _, l := range []*limiter.TimesLimiter{ts, ts, idle} {
+		if err := l.Start(2 * time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	clock.BlockUntil(2)
+	// 达到清除时间但未到清理时间
+	clock.Advance(time.Minute)
+	if stats := ts.Stats(); stats.Keys != 2500 {
+		t.Errorf("need: {2500 0 0 0}, got: %v\n", stats)
+	}
+	clock.Advance(time.Minute)
+	// 等待后台清理完成
+	for i := 0; i < 1000 && ts.Stats().Keys > 0; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	ts.Stop()
+	ts.Stop()
+	if stats := ts.Stats(); stats.Keys != 0 || stats.Swept != 2500 {
+		t.Errorf("need: {0 0 0 2500}, got: %v\n", stats)
+	}
+	// 空闲 2 分钟，尚未超时
+	if stats := idle.Stats(); stats.Keys != 2501 || stats.Swept != 0 {
+		t.Errorf("need: {2501 1 0 0}, got: %v\n", stats)
+	}
+	clock.Advance(2 * time.Minute)
+	for i := 0; i < 1000 && idle.Stats().Keys > 1; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	idle.Stop()
+	if stats := idle.Stats(); stats.Keys != 1 || stats.Limited != 1 || stats.Swept != 2500 {
+		t.Errorf("need: {1 1 0 2500}, got: %v\n", stats)
+	}
+}
+
+func TestTimesLimiter_Shards(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	ts := limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{Shards: 4, MaxKeys: 100, Clock: clock})
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				ts.AddOneTimes(strconv.Itoa(i*1000 + j))
 			}
+		}(i)
+	}
+	wg.Wait()
+	// 所有分段的 key 数量之和不超过 MaxKeys
+	if stats := ts.Stats(); stats.Keys > 100 || stats.Keys+int(stats.Evicted) != 8000 {
+		t.Errorf("need: keys <= 100 and keys+evicted = 8000, got: %v\n", stats)
+	}
+	for i := 0; i < 6; i++ {
+		ts.AddOneTimes("key")
+	}
+	if limitIn, _ := ts.CheckLimit("key"); limitIn != time.Minute {
+		t.Errorf("need: %v, got: %v\n", time.Minute, limitIn)
+	}
+}
+
+func TestTimesLimiter_MaxKeysAcrossShards(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	// MaxKeys 小于分段数时，新增 key 所在的分段没有其他 key，需要淘汰其他分段的 key
+	ts := limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{MaxKeys: 3, Clock: clock})
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		ts.AddOneTimes(key)
+		if stats := ts.Stats(); stats.Keys > 3 {
+			t.Fatalf("need: keys <= 3, got: %v\n", stats)
 		}
-	})
+		// 刚增加次数的 key 不会被淘汰
+		if _, ok := ts.Get(key); !ok {
+			t.Fatalf("need: %s not evicted\n", key)
+		}
+	}
+	if stats := ts.Stats(); stats.Keys != 3 || stats.Evicted != 97 {
+		t.Errorf("need: 3 keys and 97 evicted, got: %v\n", stats)
+	}
 }
 
-// 重置当前时间
-func callAt(t time.Time, call func()) {
-	x_time.Now = func() time.Time {
-		return t
+// 分段数为 1 时所有 key 竞争同一把锁，增加 GOMAXPROCS 后吞吐量不再提升，分段后吞吐量随 GOMAXPROCS 提升:
+//
+//	go test -run none -bench TimesLimiter -cpu 1,2,4,8 ./pkg/limiter
+func BenchmarkTimesLimiter(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = "login_ip:" + strconv.Itoa(i)
+	}
+	for _, shards := range []int{1, limiter.DefaultShards} {
+		b.Run("shards="+strconv.Itoa(shards), func(b *testing.B) {
+			ts := limiter.NewTimesLimiterWithOptions(stepProvider, limiter.TimesLimiterOptions{Shards: shards})
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					key := keys[i%len(keys)]
+					if i%4 == 0 {
+						ts.AddOneTimes(key)
+					} else {
+						ts.CheckLimit(key)
+					}
+					i++
+				}
+			})
+		})
 	}
-	call()
-	x_time.Now = time.Now
 }
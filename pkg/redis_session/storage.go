@@ -0,0 +1,89 @@
+package redis_session
+
+import (
+	"context"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/pkg/session"
+	"time"
+)
+
+// 基于 redis.UniversalClient 的 token 存储器，支持单节点、哨兵及集群模式。
+// 同一用户的 key 使用用户 ID 作为 hash tag，集群模式下位于同一个 slot，
+// 用户的 token 列表保存在集合中，RemoveUser 无需使用 KEYS 命令遍历。
+// key 格式与 session.RedisStorage(keyPrefix + id + "_" + token)不同且不读取旧格式，
+// 由 session.NewRedisStorage 切换至本存储器后已保存的 token 全部失效，所有用户需要重新登陆
+type storage struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+func NewStorage(keyPrefix string, client redis.UniversalClient) session.Storage {
+	return &storage{keyPrefix: keyPrefix, client: client}
+}
+
+// 用户 token 集合
+func (s *storage) userKey(id string) string {
+	return s.keyPrefix + "{" + id + "}"
+}
+
+func (s *storage) tokenKey(id, token string) string {
+	return s.userKey(id) + "_" + token
+}
+
+func (s *storage) SaveToken(id, token string, expires int64) error {
+	ctx := context.Background()
+	expiration := time.Duration(expires) * time.Second
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, s.tokenKey(id, token), "1", expiration)
+		pipe.SAdd(ctx, s.userKey(id), token)
+		pipe.Expire(ctx, s.userKey(id), expiration)
+		return nil
+	})
+	return err
+}
+
+func (s *storage) CheckAndRefreshToken(id, token string, expires int64) (ok bool, err error) {
+	ctx := context.Background()
+	key := s.tokenKey(id, token)
+	savedToken, err := s.client.Get(ctx, key).Result()
+	if err != nil && err != redis.Nil {
+		return false, err
+	}
+	if savedToken != "1" {
+		return false, nil
+	}
+	expiration := time.Duration(expires) * time.Second
+	_, err = s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, key, expiration)
+		pipe.Expire(ctx, s.userKey(id), expiration)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *storage) RemoveToken(id, token string) error {
+	ctx := context.Background()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, s.tokenKey(id, token))
+		pipe.SRem(ctx, s.userKey(id), token)
+		return nil
+	})
+	return err
+}
+
+func (s *storage) RemoveUser(id string) error {
+	ctx := context.Background()
+	tokens, err := s.client.SMembers(ctx, s.userKey(id)).Result()
+	if err != nil && err != redis.Nil {
+		return err
+	}
+	keys := make([]string, 0, len(tokens)+1)
+	for _, token := range tokens {
+		keys = append(keys, s.tokenKey(id, token))
+	}
+	keys = append(keys, s.userKey(id))
+	return s.client.Del(ctx, keys...).Err()
+}
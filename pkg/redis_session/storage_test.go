@@ -0,0 +1,70 @@
+package redis_session_test
+
+import (
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/redis_session"
+	"testing"
+	"time"
+)
+
+func TestStorage(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	defer client.Close()
+	storage := redis_session.NewStorage("session_", client)
+
+	for _, token := range []string{"token_01", "token_02", "token_03"} {
+		err = storage.SaveToken("1", token, 60)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !mr.Exists("session_{1}_token_01") {
+		t.Errorf("need key: session_{1}_token_01\n")
+	}
+	mr.FastForward(30 * time.Second)
+	ok, err := storage.CheckAndRefreshToken("1", "token_01", 60)
+	if err != nil || !ok {
+		t.Errorf("token_01 need: true, got: %t, %v\n", ok, err)
+	}
+	mr.FastForward(40 * time.Second)
+	for token, need := range map[string]bool{"token_01": true, "token_02": false, "not_exist": false} {
+		ok, err = storage.CheckAndRefreshToken("1", token, 60)
+		if err != nil || ok != need {
+			t.Errorf("%s need: %t, got: %t, %v\n", token, need, ok, err)
+		}
+	}
+	_ = storage.SaveToken("1", "token_04", 60)
+	_ = storage.SaveToken("2", "token_05", 60)
+	err = storage.RemoveToken("1", "token_04")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, _ = storage.CheckAndRefreshToken("1", "token_04", 60)
+	if ok {
+		t.Errorf("token_04 need: false, got: true\n")
+	}
+	err = storage.RemoveUser("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, _ = storage.CheckAndRefreshToken("1", "token_01", 60)
+	if ok {
+		t.Errorf("token_01 need: false after remove user, got: true\n")
+	}
+	ok, _ = storage.CheckAndRefreshToken("2", "token_05", 60)
+	if !ok {
+		t.Errorf("token_05 need: true, got: false\n")
+	}
+	// 旧格式的 token 不再有效
+	_ = mr.Set("session_2_token_06", "1")
+	ok, _ = storage.CheckAndRefreshToken("2", "token_06", 60)
+	if ok {
+		t.Errorf("legacy token_06 need: false, got: true\n")
+	}
+}
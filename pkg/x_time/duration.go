@@ -0,0 +1,36 @@
+package x_time
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// 可从文本配置(toml、json 等)中解析的时间长度，支持 "1m30s" 等 time.ParseDuration 格式，也支持整数纳秒
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	s := string(text)
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		*d = Duration(n)
+		return nil
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("x_time: invalid duration %q", s)
+	}
+	*d = Duration(v)
+	return nil
+}
@@ -0,0 +1,28 @@
+package x_time_test
+
+import (
+	"github.com/morgine/moon/pkg/x_time"
+	"testing"
+	"time"
+)
+
+func TestDuration_UnmarshalText(t *testing.T) {
+	for text, need := range map[string]time.Duration{
+		"1m30s":      90 * time.Second,
+		"500ms":      500 * time.Millisecond,
+		"1000000000": time.Second,
+		"0":          0,
+	} {
+		var d x_time.Duration
+		if err := d.UnmarshalText([]byte(text)); err != nil || d.Duration() != need {
+			t.Errorf("%s need: %v, got: %v, %v\n", text, need, d, err)
+		}
+	}
+	var d x_time.Duration
+	if err := d.UnmarshalText([]byte("1x")); err == nil {
+		t.Error("need error, got: nil")
+	}
+	if text, _ := x_time.Duration(90 * time.Second).MarshalText(); string(text) != "1m30s" {
+		t.Errorf("need: 1m30s, got: %s\n", text)
+	}
+}
@@ -0,0 +1,160 @@
+package x_time
+
+import (
+	"sync"
+	"time"
+)
+
+// 手动推进时间的时钟，仅用于测试。
+// 时间只在调用 Advance 或 Set 时变化，到期的定时器按到期时间顺序触发，与 time 包一致，通道已满时丢弃本次触发
+type Fake struct {
+	now     time.Time
+	waiters []*fakeWaiter
+	mu      sync.Mutex
+	cond    *sync.Cond
+}
+
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// 推进时间并触发到期的定时器
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.advanceTo(f.now.Add(d))
+}
+
+// 设置当前时间，早于当前时间时不触发任何定时器
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if t.After(f.now) {
+		f.advanceTo(t)
+	} else {
+		f.now = t
+	}
+}
+
+// 阻塞直到存在 n 个未停止的定时器，用于等待后台协程创建定时器后再推进时间
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	return f.addWaiter(d, 0)
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("x_time: non-positive interval for NewTicker")
+	}
+	return fakeTicker{f.addWaiter(d, d)}
+}
+
+func (f *Fake) addWaiter(d, period time.Duration) *fakeWaiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w := &fakeWaiter{clock: f, c: make(chan time.Time, 1), period: period}
+	f.schedule(w, f.now.Add(d))
+	return w
+}
+
+// 按到期时间依次触发定时器，需要上锁
+func (f *Fake) advanceTo(t time.Time) {
+	for {
+		w := f.next()
+		if w == nil || w.at.After(t) {
+			break
+		}
+		f.now = w.at
+		select {
+		case w.c <- w.at:
+		default:
+		}
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			f.unschedule(w)
+		}
+	}
+	f.now = t
+}
+
+// 最早到期的定时器，需要上锁
+func (f *Fake) next() *fakeWaiter {
+	var next *fakeWaiter
+	for _, w := range f.waiters {
+		if next == nil || w.at.Before(next.at) {
+			next = w
+		}
+	}
+	return next
+}
+
+// 需要上锁
+func (f *Fake) schedule(w *fakeWaiter, at time.Time) {
+	w.at = at
+	f.waiters = append(f.waiters, w)
+	f.cond.Broadcast()
+	// 与 time 包一致，到期时间不晚于当前时间的定时器立即触发
+	if !at.After(f.now) {
+		f.advanceTo(f.now)
+	}
+}
+
+// 需要上锁，返回定时器是否处于等待状态
+func (f *Fake) unschedule(w *fakeWaiter) bool {
+	for i, waiter := range f.waiters {
+		if waiter == w {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type fakeWaiter struct {
+	clock  *Fake
+	at     time.Time
+	period time.Duration // 大于 0 表示周期定时器
+	c      chan time.Time
+}
+
+func (w *fakeWaiter) C() <-chan time.Time {
+	return w.c
+}
+
+func (w *fakeWaiter) Stop() bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	return w.clock.unschedule(w)
+}
+
+func (w *fakeWaiter) Reset(d time.Duration) bool {
+	w.clock.mu.Lock()
+	defer w.clock.mu.Unlock()
+	active := w.clock.unschedule(w)
+	w.clock.schedule(w, w.clock.now.Add(d))
+	return active
+}
+
+type fakeTicker struct {
+	*fakeWaiter
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeWaiter.Stop()
+}
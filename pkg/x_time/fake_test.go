@@ -0,0 +1,73 @@
+package x_time_test
+
+import (
+	"github.com/morgine/moon/pkg/x_time"
+	"testing"
+	"time"
+)
+
+func TestFake(t *testing.T) {
+	start := time.Date(2020, 12, 1, 0, 0, 0, 0, time.UTC)
+	clock := x_time.NewFake(start)
+	timer := clock.NewTimer(time.Minute)
+	ticker := clock.NewTicker(40 * time.Second)
+	clock.Advance(30 * time.Second)
+	if got := clock.Now(); !got.Equal(start.Add(30 * time.Second)) {
+		t.Errorf("need: %v, got: %v\n", start.Add(30*time.Second), got)
+	}
+	select {
+	case <-timer.C():
+		t.Error("timer fired early")
+	case <-ticker.C():
+		t.Error("ticker fired early")
+	default:
+	}
+	clock.Advance(30 * time.Second)
+	// 定时器以到期时间触发
+	if got := <-ticker.C(); !got.Equal(start.Add(40 * time.Second)) {
+		t.Errorf("ticker need: %v, got: %v\n", start.Add(40*time.Second), got)
+	}
+	if got := <-timer.C(); !got.Equal(start.Add(time.Minute)) {
+		t.Errorf("timer need: %v, got: %v\n", start.Add(time.Minute), got)
+	}
+	// 通道已满时丢弃触发
+	clock.Advance(2 * time.Minute)
+	if got := <-ticker.C(); !got.Equal(start.Add(80 * time.Second)) {
+		t.Errorf("ticker need: %v, got: %v\n", start.Add(80*time.Second), got)
+	}
+	select {
+	case <-ticker.C():
+		t.Error("ticker need: dropped ticks, got: tick")
+	default:
+	}
+	if timer.Stop() {
+		t.Error("fired timer stop need: false, got: true")
+	}
+	if timer.Reset(time.Second) {
+		t.Error("fired timer reset need: false, got: true")
+	}
+	if !timer.Stop() {
+		t.Error("pending timer stop need: true, got: false")
+	}
+	ticker.Stop()
+	clock.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Error("stopped timer fired")
+	case <-ticker.C():
+		t.Error("stopped ticker fired")
+	default:
+	}
+}
+
+func TestFake_BlockUntil(t *testing.T) {
+	clock := x_time.NewFake(time.Now())
+	fired := make(chan struct{})
+	go func() {
+		<-clock.NewTimer(time.Second).C()
+		close(fired)
+	}()
+	clock.BlockUntil(1)
+	clock.Advance(time.Second)
+	<-fired
+}
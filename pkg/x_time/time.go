@@ -2,5 +2,66 @@ package x_time
 
 import "time"
 
-// 可重新定义的获取当前时间的函数
-var Now = time.Now
+// 时钟，用于获取当前时间及创建定时器。业务代码依赖该接口而不是直接调用 time 包，
+// 测试时可替换为 Fake 以确定性地控制时间
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+	NewTicker(d time.Duration) Ticker
+}
+
+// 定时器，对应 time.Timer
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// 周期定时器，对应 time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// 返回使用系统时间的时钟
+func Real() Clock {
+	return realClock{}
+}
+
+// 返回 clock，clock 为 nil 时返回 Real()，用于配置中的可选时钟
+func Or(clock Clock) Clock {
+	if clock == nil {
+		return Real()
+	}
+	return clock
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (t realTimer) C() <-chan time.Time {
+	return t.Timer.C
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
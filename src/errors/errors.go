@@ -1,11 +1,15 @@
 package errors
 
-import "fmt"
+import (
+	"fmt"
+	"time"
+)
 
 const (
-	StatusUnknown  Code = -1
-	StatusOK       Code = 200
-	StatusNotFound Code = 404
+	StatusUnknown         Code = -1
+	StatusOK              Code = 200
+	StatusNotFound        Code = 404
+	StatusTooManyRequests Code = 429
 )
 
 const (
@@ -13,20 +17,31 @@ const (
 	UsernameIncorrectFormat     Code = 6002
 	PasswordIncorrectFormat     Code = 6003
 	UsernameOrPasswordIncorrect Code = 6100
+	IPTemporarilyLocked         Code = 6101
+	UserTemporarilyLocked       Code = 6102
 	GoogleAuthCodeIncorrect     Code = 6200
+	GoogleAuthNotBound          Code = 6201
+	GoogleAuthAlreadyBound      Code = 6202
 	UserUnauthorized            Code = 6300
+	RecommenderCycle            Code = 6400
 )
 
 var Texts = map[Code]string{
 	StatusUnknown:               "其他错误",
 	StatusOK:                    "OK",
 	StatusNotFound:              "Not Found",
+	StatusTooManyRequests:       "请求过于频繁",
 	UsernameAlreadyRegistered:   "用户名已注册",
 	UsernameIncorrectFormat:     "用户名格式错误",
 	PasswordIncorrectFormat:     "密码格式错误",
 	UsernameOrPasswordIncorrect: "用户名或密码错误",
+	IPTemporarilyLocked:         "登陆失败次数过多，IP 已被暂时锁定",
+	UserTemporarilyLocked:       "登陆失败次数过多，账户已被暂时锁定",
 	GoogleAuthCodeIncorrect:     "谷歌验证码出错",
+	GoogleAuthNotBound:          "未绑定谷歌验证器",
+	GoogleAuthAlreadyBound:      "已绑定谷歌验证器",
 	UserUnauthorized:            "用户未登陆",
+	RecommenderCycle:            "推荐关系存在循环",
 }
 
 // Code 错误码，紧用于提示前端，前端需要根据业务需要再详细提示用户
@@ -41,3 +56,13 @@ func Unwrap(err error) (code Code, ok bool) {
 	code, ok = err.(Code)
 	return
 }
+
+// LockedError 暂时锁定错误，LimitIn 为剩余锁定时间
+type LockedError struct {
+	Code    Code
+	LimitIn time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s, limit in: %s", e.Code.Error(), e.LimitIn)
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net"
+	"strings"
+)
+
+// 可信代理，只有直连地址为可信代理时才使用 X-Forwarded-For，避免客户端伪造 IP 绕过按 IP 的限制
+type TrustedProxies []*net.IPNet
+
+// 解析可信代理列表，每项为 IP 或 CIDR，如 "10.0.0.1"、"10.0.0.0/8"
+func ParseTrustedProxies(proxies []string) (TrustedProxies, error) {
+	nets := make(TrustedProxies, 0, len(proxies))
+	for _, proxy := range proxies {
+		if !strings.Contains(proxy, "/") {
+			ip := net.ParseIP(proxy)
+			if ip == nil {
+				return nil, fmt.Errorf("handlers: invalid trusted proxy %q", proxy)
+			}
+			if ip.To4() != nil {
+				proxy += "/32"
+			} else {
+				proxy += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("handlers: invalid trusted proxy %q", proxy)
+		}
+		nets = append(nets, ipNet)
+	}
+	return nets, nil
+}
+
+func (tp TrustedProxies) trusted(ip net.IP) bool {
+	for _, ipNet := range tp {
+		if ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// 获得客户端 IP。直连地址不是可信代理时直接使用直连地址，否则从右向左跳过 X-Forwarded-For 中的可信代理，
+// 返回第一个不可信的地址，格式错误时返回最后一个可信代理的地址
+func (tp TrustedProxies) ClientIP(ctx *gin.Context) string {
+	remote := remoteIP(ctx)
+	ip := net.ParseIP(remote)
+	if ip == nil || !tp.trusted(ip) {
+		return remote
+	}
+	hops := strings.Split(strings.Join(ctx.Request.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			break
+		}
+		remote = hop.String()
+		if !tp.trusted(hop) {
+			break
+		}
+	}
+	return remote
+}
+
+// 直连地址，不读取任何请求头
+func remoteIP(ctx *gin.Context) string {
+	host, _, err := net.SplitHostPort(strings.TrimSpace(ctx.Request.RemoteAddr))
+	if err != nil {
+		return ctx.Request.RemoteAddr
+	}
+	return host
+}
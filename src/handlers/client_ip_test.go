@@ -0,0 +1,43 @@
+package handlers_test
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/morgine/moon/src/handlers"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTrustedProxies_ClientIP(t *testing.T) {
+	proxies, err := handlers.ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		remote, forwarded, need string
+	}{
+		// 直连地址不可信，忽略伪造的请求头
+		{"1.2.3.4:1000", "9.9.9.9", "1.2.3.4"},
+		{"192.168.1.1:1000", "", "192.168.1.1"},
+		{"192.168.1.1:1000", "9.9.9.9, 1.2.3.4", "1.2.3.4"},
+		// 跳过多层可信代理
+		{"10.0.0.1:1000", "9.9.9.9, 1.2.3.4, 10.0.0.2", "1.2.3.4"},
+		{"10.0.0.1:1000", "bad, 10.0.0.2", "10.0.0.2"},
+	}
+	for _, test := range tests {
+		ctx, _ := gin.CreateTestContext(httptest.NewRecorder())
+		ctx.Request = httptest.NewRequest("GET", "/", nil)
+		ctx.Request.RemoteAddr = test.remote
+		if test.forwarded != "" {
+			ctx.Request.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+		if got := proxies.ClientIP(ctx); got != test.need {
+			t.Errorf("%s %s need: %s, got: %s\n", test.remote, test.forwarded, test.need, got)
+		}
+		if got := handlers.TrustedProxies(nil).ClientIP(ctx); got != test.remote[:len(test.remote)-5] {
+			t.Errorf("need remote address, got: %s\n", got)
+		}
+	}
+	if _, err = handlers.ParseTrustedProxies([]string{"10.0.0"}); err == nil {
+		t.Error("need error, got: nil")
+	}
+}
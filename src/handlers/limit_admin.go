@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/src/errors"
+	"github.com/morgine/moon/src/models"
+	"gorm.io/gorm"
+)
+
+// 限制管理，供客服查看及解除登陆锁定等限制，每次操作均记录至审计表
+type LimitAdmin struct {
+	m              *models.Model
+	limiter        limiter.Limiter
+	inspector      limiter.Inspector
+	trustedProxies TrustedProxies
+	opts           *LimitAdminOptions
+}
+
+type LimitAdminOptions struct {
+	DB       *gorm.DB                                          // 数据库 ORM，用于保存操作记录
+	Limiter  limiter.Limiter                                   // 被管理的限制器，需要实现 limiter.Inspector，如 Options.LoginLimiter
+	Operator func(ctx *gin.Context) (operator string, ok bool) // 获得管理员标识，ok 为 false 表示未通过管理员鉴权
+	// 可信反向代理的 IP 或 CIDR，仅来自这些地址的请求使用 X-Forwarded-For 作为操作记录中的 IP，为空则使用直连地址
+	TrustedProxies []string
+}
+
+func NewLimitAdmin(opts *LimitAdminOptions) (*LimitAdmin, error) {
+	inspector, ok := opts.Limiter.(limiter.Inspector)
+	if !ok {
+		return nil, fmt.Errorf("handlers: limiter %T does not implement limiter.Inspector", opts.Limiter)
+	}
+	if opts.Operator == nil {
+		return nil, fmt.Errorf("handlers: limit admin operator is nil")
+	}
+	trustedProxies, err := ParseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	err = opts.DB.AutoMigrate(&models.LimitAudit{})
+	if err != nil {
+		return nil, err
+	}
+	return &LimitAdmin{
+		m:              &models.Model{DB: opts.DB},
+		limiter:        opts.Limiter,
+		inspector:      inspector,
+		trustedProxies: trustedProxies,
+		opts:           opts,
+	}, nil
+}
+
+// 限制列表
+type LimitList struct {
+	Total int
+	Items []limiter.KeyLimit
+}
+
+// 按 key 前缀分页列出未达到清除时间的限制，如 login_ip: 及 login_username: 分别为登陆 IP 及登陆用户名的限制
+func (la *LimitAdmin) ListLimits() gin.HandlerFunc {
+	type params struct {
+		Prefix string
+		Page   int // 页码，从 1 开始
+		Size   int // 每页条数，默认 20，最大 100
+	}
+	return func(ctx *gin.Context) {
+		operator, ok := la.operator(ctx)
+		if ok {
+			ps := &params{}
+			err := ctx.Bind(ps)
+			if err != nil {
+				SendError(ctx, err)
+			} else {
+				if ps.Page < 1 {
+					ps.Page = 1
+				}
+				if ps.Size < 1 || ps.Size > 100 {
+					ps.Size = 20
+				}
+				err = la.audit(ctx, operator, models.LimitAuditList, ps.Prefix, fmt.Sprintf("page=%d size=%d", ps.Page, ps.Size))
+				if err != nil {
+					SendError(ctx, err)
+				} else {
+					items, total, err := la.inspector.List(ctx.Request.Context(), ps.Prefix, (ps.Page-1)*ps.Size, ps.Size)
+					if err != nil {
+						SendError(ctx, err)
+					} else {
+						SendJSON(ctx, LimitList{Total: total, Items: items})
+					}
+				}
+			}
+		}
+	}
+}
+
+// 查看限制详情，限制不存在或已达到清除时间时返回 StatusNotFound
+func (la *LimitAdmin) GetLimit() gin.HandlerFunc {
+	type params struct {
+		Key string
+	}
+	return func(ctx *gin.Context) {
+		operator, ok := la.operator(ctx)
+		if ok {
+			ps := &params{}
+			err := ctx.Bind(ps)
+			if err != nil {
+				SendError(ctx, err)
+			} else {
+				err = la.audit(ctx, operator, models.LimitAuditInspect, ps.Key, "")
+				if err != nil {
+					SendError(ctx, err)
+				} else {
+					limit, found, err := la.inspector.Get(ctx.Request.Context(), ps.Key)
+					if err != nil {
+						SendError(ctx, err)
+					} else if !found {
+						SendError(ctx, errors.StatusNotFound)
+					} else {
+						SendJSON(ctx, limiter.KeyLimit{Key: ps.Key, Limit: limit})
+					}
+				}
+			}
+		}
+	}
+}
+
+// 解除限制，操作记录中保存解除前的限制
+func (la *LimitAdmin) RemoveLimit() gin.HandlerFunc {
+	type params struct {
+		Key string
+	}
+	return func(ctx *gin.Context) {
+		operator, ok := la.operator(ctx)
+		if ok {
+			ps := &params{}
+			err := ctx.Bind(ps)
+			if err != nil {
+				SendError(ctx, err)
+			} else {
+				err = la.auditRemove(ctx, operator, ps.Key)
+				if err != nil {
+					SendError(ctx, err)
+				} else {
+					err = la.limiter.RemoveLimit(ctx.Request.Context(), ps.Key)
+					if err != nil {
+						SendError(ctx, err)
+					} else {
+						SendMessage(ctx, errors.StatusOK, "已解除")
+					}
+				}
+			}
+		}
+	}
+}
+
+// 获得管理员标识，未通过鉴权时返回 UserUnauthorized
+func (la *LimitAdmin) operator(ctx *gin.Context) (string, bool) {
+	operator, ok := la.opts.Operator(ctx)
+	if !ok {
+		SendError(ctx, errors.UserUnauthorized)
+	}
+	return operator, ok
+}
+
+// 记录操作，操作在记录成功后才执行，保证所有操作均有记录
+func (la *LimitAdmin) audit(ctx *gin.Context, operator, action, key, detail string) error {
+	return la.m.AddLimitAudit(ctx.Request.Context(), &models.LimitAudit{
+		Operator: operator,
+		Action:   action,
+		LimitKey: key,
+		Detail:   detail,
+		IP:       la.trustedProxies.ClientIP(ctx),
+	})
+}
+
+// 记录解除限制操作，详情为解除前限制的 JSON 格式，限制不存在时为空
+func (la *LimitAdmin) auditRemove(ctx *gin.Context, operator, key string) error {
+	var detail string
+	limit, found, err := la.inspector.Get(ctx.Request.Context(), key)
+	if err != nil {
+		return err
+	}
+	if found {
+		data, err := json.Marshal(limit)
+		if err != nil {
+			return err
+		}
+		detail = string(data)
+	}
+	return la.audit(ctx, operator, models.LimitAuditRemove, key, detail)
+}
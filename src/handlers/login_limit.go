@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/morgine/moon/src/errors"
+)
+
+// 登陆限制 key，IP 及用户名分别计数
+func (usr *User) loginLimitKeys(ctx *gin.Context, username string) (ipKey, usernameKey string) {
+	return "login_ip:" + usr.trustedProxies.ClientIP(ctx), "login_username:" + username
+}
+
+// 验证密码之前检查 IP 是否被锁定，并记录一次用户名的登陆次数，已被暂时锁定则返回 LockedError，未设置限制器则不限制。
+// 用户名的检查与记录是原子操作，并发请求不能在记录次数之前全部通过检查。
+// IP 只在密码错误时记录次数，避免共享出口 IP(如公司网络)的用户因正常登陆被锁定
+func (usr *User) checkLoginAttempt(ctx *gin.Context, username string) error {
+	if usr.opts.LoginLimiter == nil {
+		return nil
+	}
+	ipKey, usernameKey := usr.loginLimitKeys(ctx, username)
+	limitIn, _, err := usr.opts.LoginLimiter.CheckLimit(ctx.Request.Context(), ipKey)
+	if err != nil {
+		return err
+	}
+	if limitIn > 0 {
+		return &errors.LockedError{Code: errors.IPTemporarilyLocked, LimitIn: limitIn}
+	}
+	allowed, limitIn, err := usr.opts.LoginLimiter.CheckAndAdd(ctx.Request.Context(), usernameKey)
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return &errors.LockedError{Code: errors.UserTemporarilyLocked, LimitIn: limitIn}
+	}
+	return nil
+}
+
+// 用户名或密码错误，记录一次 IP 的登陆次数
+func (usr *User) addLoginFailure(ctx *gin.Context, username string) error {
+	if usr.opts.LoginLimiter == nil {
+		return nil
+	}
+	ipKey, _ := usr.loginLimitKeys(ctx, username)
+	_, _, err := usr.opts.LoginLimiter.AddOneTimes(ctx.Request.Context(), ipKey)
+	return err
+}
+
+// 密码正确，清除用户名的登陆次数，IP 的登陆次数只记录失败，无需清除
+func (usr *User) clearLoginAttempts(ctx *gin.Context, username string) error {
+	if usr.opts.LoginLimiter == nil {
+		return nil
+	}
+	_, usernameKey := usr.loginLimitKeys(ctx, username)
+	return usr.opts.LoginLimiter.RemoveLimit(ctx.Request.Context(), usernameKey)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/src/errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// 速率限制中间件，可用于路由组，每个中间件使用独立的限制器。
+// keyFunc 返回限制 key，为空则按直连地址限制(不信任 X-Forwarded-For)，位于反向代理之后时可传入 TrustedProxies.ClientIP。
+// 响应头包含 RateLimit-Limit、RateLimit-Remaining 及 RateLimit-Reset，请求被拒绝时返回 429 及 Retry-After
+func RateLimit(rl limiter.RateLimiter, keyFunc func(ctx *gin.Context) string) gin.HandlerFunc {
+	if keyFunc == nil {
+		keyFunc = TrustedProxies(nil).ClientIP
+	}
+	return func(ctx *gin.Context) {
+		result := rl.Allow(keyFunc(ctx))
+		header := ctx.Writer.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", seconds(result.Reset))
+		if !result.Allowed {
+			header.Set("Retry-After", seconds(result.RetryAfter))
+			ctx.AbortWithStatusJSON(http.StatusTooManyRequests, Message{
+				Status:  errors.StatusTooManyRequests,
+				Message: errors.Texts[errors.StatusTooManyRequests],
+			})
+		}
+	}
+}
+
+// 向上取整的秒数
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
+
+// 注册及登陆接口的速率限制中间件，按客户端 IP 限制，未设置 Options.RateLimiter 时不限制
+func (usr *User) RateLimit() gin.HandlerFunc {
+	if usr.opts.RateLimiter == nil {
+		return func(ctx *gin.Context) {}
+	}
+	return RateLimit(usr.opts.RateLimiter, usr.trustedProxies.ClientIP)
+}
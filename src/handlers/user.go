@@ -2,57 +2,101 @@ package handlers
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/morgine/moon/pkg/cache"
 	"github.com/morgine/moon/pkg/google_authenticator"
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/pkg/x_time"
 	"github.com/morgine/moon/src/errors"
 	"github.com/morgine/moon/src/models"
 	"github.com/morgine/moon/src/validators"
 	"github.com/morgine/pkg/crypt/aes"
 	"github.com/morgine/pkg/session"
 	"gorm.io/gorm"
+	"net/http"
 	"regexp"
 	"strconv"
 	"time"
 )
 
-var Now = time.Now
-
 type User struct {
-	m    *models.Model
-	opts *Options
+	m                     *models.Model
+	opts                  *Options
+	clock                 x_time.Clock
+	trustedProxies        TrustedProxies
+	recommendersNamespace *cache.NamespaceClient
 }
 
 type Options struct {
-	DB           *gorm.DB                    // 数据库 ORM
-	CacheClient  cache.Client                // 数据缓存客户端
-	Session      session.Storage             // token 存储器
-	AuthExpires  int64                       // 会话过期时间
-	AesCryptKey  []byte                      // 16 位字符串
-	QRCodeConfig google_authenticator.Config // 谷歌验证器配置文件
+	DB             *gorm.DB                    // 数据库 ORM
+	CacheClient    cache.Client                // 数据缓存客户端，同时用于记录已使用的谷歌验证码(QRCodeConfig 未设置缓存时)
+	Session        session.Storage             // token 存储器
+	AuthExpires    int64                       // 会话过期时间
+	AesCryptKey    []byte                      // 16 位字符串
+	QRCodeConfig   google_authenticator.Config // 谷歌验证器配置文件
+	LoginLimiter   limiter.Limiter             // 登陆次数限制器，可使用内存或 Redis 实现，为空则不限制
+	RateLimiter    limiter.RateLimiter         // 注册及登陆接口的速率限制器，按客户端 IP 限制，为空则不限制
+	TrustedProxies []string                    // 可信反向代理的 IP 或 CIDR，仅来自这些地址的请求使用 X-Forwarded-For 作为客户端 IP，为空则使用直连地址
+	Clock          x_time.Clock                // 时钟，用于生成 token 及验证谷歌验证码(QRCodeConfig 未设置时钟时)，为空则使用系统时间
 }
 
 func NewUser(opts *Options) (*User, error) {
-	err := opts.DB.AutoMigrate(&User{})
+	err := opts.DB.AutoMigrate(&models.User{}, &models.RecoveryCode{})
 	if err != nil {
 		return nil, err
 	}
-	recommendersClient := cache.WithPrefixClient("recommenders_", opts.CacheClient)
+	trustedProxies, err := ParseTrustedProxies(opts.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	clock := x_time.Or(opts.Clock)
+	gacConfig := opts.QRCodeConfig
+	if gacConfig.Clock == nil {
+		gacConfig.Clock = clock
+	}
+	if gacConfig.Cache == nil {
+		// 防止谷歌验证码重放
+		gacConfig.Cache = cache.WithPrefixClient("google_authenticator_", opts.CacheClient)
+	}
+	recommendersClient := cache.WithNamespaceClient(cache.HashTag("recommenders_"), opts.CacheClient, cache.NamespaceConfig{
+		MaxExpiration:  24 * time.Hour,
+		VersionRefresh: time.Second,
+		Clock:          clock,
+	})
+	chainsClient := cache.WithNamespaceClient(cache.HashTag("recommender_chains_"), opts.CacheClient, cache.NamespaceConfig{
+		MaxExpiration:  24 * time.Hour,
+		VersionRefresh: time.Second,
+		Clock:          clock,
+	})
 	return &User{
 		m: &models.Model{
 			DB:  opts.DB,
-			GAC: google_authenticator.NewClient(opts.QRCodeConfig),
+			GAC: google_authenticator.NewClient(gacConfig),
 			UserValidator: validators.NewUser(
 				regexp.MustCompile("^[a-z0-9]{8,16}$"), // 用户名验证器
 				regexp.MustCompile("^[\\w]{8,16}$"),    // 密码验证器
 			),
-			RecommendersCache: cache.NewRecommenders(recommendersClient),
+			RecommendersCache: cache.NewRecommenders(recommendersClient, time.Minute),
+			ChainsCache:       cache.NewRecommenderChains(chainsClient),
 		},
-		opts: opts,
+		opts:                  opts,
+		clock:                 clock,
+		trustedProxies:        trustedProxies,
+		recommendersNamespace: recommendersClient,
 	}, nil
 }
 
+// 使所有推荐人缓存及推荐人链缓存失效，用于修改数据库中的推荐关系后(如数据迁移)
+func (usr *User) InvalidateRecommenders(ctx context.Context) error {
+	_, err := usr.recommendersNamespace.Bump(ctx)
+	if err != nil {
+		return err
+	}
+	return usr.m.ChainsCache.InvalidateAll(ctx)
+}
+
 // 注册账号，并绑定推荐人
 func (usr *User) Register() gin.HandlerFunc {
 	type params struct {
@@ -131,7 +175,20 @@ func (usr *User) GetInfo(ctx *gin.Context) {
 	}
 }
 
-// Login 登陆账号
+// 获得登陆用户的推荐人 ID，请求的 context 将传递至缓存及数据库
+func (usr *User) GetRecommender(ctx *gin.Context) {
+	userID, ok := usr.GetLoginUser(ctx)
+	if ok {
+		recommenderID, err := usr.m.GetRecommender(ctx.Request.Context(), userID)
+		if err != nil {
+			SendError(ctx, err)
+		} else {
+			SendJSON(ctx, recommenderID)
+		}
+	}
+}
+
+// Login 登陆账号，登陆失败次数过多时暂时锁定 IP 及账户
 func (usr *User) Login() gin.HandlerFunc {
 	type params struct {
 		Username string
@@ -143,20 +200,25 @@ func (usr *User) Login() gin.HandlerFunc {
 		if err != nil {
 			SendError(ctx, err)
 		} else {
-			user, err := usr.m.LoginUser(ps.Username, ps.Password)
+			err = usr.checkLoginAttempt(ctx, ps.Username)
 			if err != nil {
 				SendError(ctx, err)
 			} else {
-				uid := strconv.Itoa(user.ID)
-				token, err := usr.encryptToken(uid)
+				user, err := usr.login(ctx, ps.Username, ps.Password)
 				if err != nil {
 					SendError(ctx, err)
 				} else {
-					err = usr.opts.Session.SaveToken(uid, token, usr.opts.AuthExpires)
+					uid := strconv.Itoa(user.ID)
+					token, err := usr.encryptToken(uid)
 					if err != nil {
 						SendError(ctx, err)
 					} else {
-						SendJSON(ctx, token)
+						err = usr.opts.Session.SaveToken(uid, token, usr.opts.AuthExpires)
+						if err != nil {
+							SendError(ctx, err)
+						} else {
+							SendJSON(ctx, token)
+						}
 					}
 				}
 			}
@@ -164,6 +226,23 @@ func (usr *User) Login() gin.HandlerFunc {
 	}
 }
 
+// 验证用户名及密码，成功则清除用户名的登陆次数，用户名或密码错误则记录一次 IP 的登陆次数，
+// 用户名的登陆次数已在验证之前记录
+func (usr *User) login(ctx *gin.Context, username, password string) (*models.User, error) {
+	user, err := usr.m.LoginUser(username, password)
+	if err == errors.UsernameOrPasswordIncorrect {
+		addErr := usr.addLoginFailure(ctx, username)
+		if addErr != nil {
+			return nil, addErr
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return user, usr.clearLoginAttempts(ctx, username)
+}
+
 // 获得谷歌验证器二维码地址
 func (usr *User) GetGoogleAuthenticatorQRCodeUrl() gin.HandlerFunc {
 	type params struct {
@@ -189,7 +268,38 @@ func (usr *User) GetGoogleAuthenticatorQRCodeUrl() gin.HandlerFunc {
 	}
 }
 
-// 绑定谷歌验证器
+// 输出谷歌验证器二维码图片，图片在本地生成，Format 可选 png(默认) 或 svg，Size 为图片边长(像素)
+func (usr *User) GoogleAuthenticatorQRCode() gin.HandlerFunc {
+	type params struct {
+		Format string
+		Size   int
+	}
+	return func(ctx *gin.Context) {
+		userID, ok := usr.GetLoginUser(ctx)
+		if ok {
+			ps := &params{}
+			err := ctx.Bind(ps)
+			if err != nil {
+				SendError(ctx, err)
+			} else {
+				format := google_authenticator.ImageFormat(ps.Format)
+				if format == "" {
+					format = google_authenticator.PNG
+				}
+				img, err := usr.m.GetGoogleAuthenticatorQRCode(userID, format, ps.Size)
+				if err != nil {
+					SendError(ctx, err)
+				} else {
+					// 二维码包含密钥，禁止缓存
+					ctx.Header("Cache-Control", "no-store")
+					ctx.Data(http.StatusOK, format.ContentType(), img)
+				}
+			}
+		}
+	}
+}
+
+// 绑定谷歌验证器，成功后返回恢复码，恢复码可在丢失验证器时代替谷歌验证码使用一次
 func (usr *User) BindGoogle() gin.HandlerFunc {
 	type params struct {
 		GoogleCode string
@@ -202,17 +312,55 @@ func (usr *User) BindGoogle() gin.HandlerFunc {
 			if err != nil {
 				SendError(ctx, err)
 			} else {
-				err := usr.m.BindGoogleAuth(userID, ps.GoogleCode)
+				codes, err := usr.m.BindGoogleAuth(ctx.Request.Context(), userID, ps.GoogleCode)
+				if err != nil {
+					SendError(ctx, err)
+				} else {
+					// 恢复码明文仅返回这一次
+					SendJSON(ctx, codes)
+				}
+			}
+		}
+	}
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码，需要谷歌验证码或未使用的恢复码，原有恢复码全部失效
+func (usr *User) RegenerateRecoveryCodes() gin.HandlerFunc {
+	type params struct {
+		GoogleCode string
+	}
+	return func(ctx *gin.Context) {
+		userID, ok := usr.GetLoginUser(ctx)
+		if ok {
+			ps := &params{}
+			err := ctx.Bind(ps)
+			if err != nil {
+				SendError(ctx, err)
+			} else {
+				codes, err := usr.m.RegenerateRecoveryCodes(ctx.Request.Context(), userID, ps.GoogleCode)
 				if err != nil {
 					SendError(ctx, err)
 				} else {
-					SendMessage(ctx, errors.StatusOK, "已绑定")
+					SendJSON(ctx, codes)
 				}
 			}
 		}
 	}
 }
 
+// GetRecoveryCodesCount 获得登陆用户剩余的恢复码数量
+func (usr *User) GetRecoveryCodesCount(ctx *gin.Context) {
+	userID, ok := usr.GetLoginUser(ctx)
+	if ok {
+		count, err := usr.m.CountRecoveryCodes(userID)
+		if err != nil {
+			SendError(ctx, err)
+		} else {
+			SendJSON(ctx, count)
+		}
+	}
+}
+
 // ResetPassword 重置密码
 func (usr *User) ResetPassword() gin.HandlerFunc {
 	type params struct {
@@ -227,7 +375,7 @@ func (usr *User) ResetPassword() gin.HandlerFunc {
 			if err != nil {
 				SendError(ctx, err)
 			} else {
-				err := usr.m.ResetPassword(userID, ps.GoogleCode, ps.NewPassword)
+				err := usr.m.ResetPassword(ctx.Request.Context(), userID, ps.GoogleCode, ps.NewPassword)
 				if err != nil {
 					SendError(ctx, err)
 				} else {
@@ -285,7 +433,7 @@ func (usr *User) SaveAvatar() gin.HandlerFunc {
 
 // token 加密
 func (usr *User) encryptToken(adminID string) (token string, err error) {
-	return aes.AesCBCEncrypt([]byte(fmt.Sprintf("%s:%10d", adminID, Now().UnixNano())), usr.opts.AesCryptKey)
+	return aes.AesCBCEncrypt([]byte(fmt.Sprintf("%s:%10d", adminID, usr.clock.Now().UnixNano())), usr.opts.AesCryptKey)
 }
 
 // token 解密
@@ -3,6 +3,7 @@ package handlers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/morgine/moon/src/errors"
+	"math"
 	"net/http"
 )
 
@@ -26,10 +27,21 @@ func SendJSON(ctx *gin.Context, data interface{}) {
 	})
 }
 
+// 暂时锁定错误的附加数据
+type LockedData struct {
+	LimitIn int64 // 剩余锁定时间(秒)
+}
+
 func SendError(ctx *gin.Context, err error) {
 	code, ok := errors.Unwrap(err)
 
-	if ok {
+	if locked, isLocked := err.(*errors.LockedError); isLocked {
+		ctx.AbortWithStatusJSON(http.StatusOK, Message{
+			Status:  locked.Code,
+			Message: errors.Texts[locked.Code],
+			Data:    LockedData{LimitIn: int64(math.Ceil(locked.LimitIn.Seconds()))},
+		})
+	} else if ok {
 		ctx.AbortWithStatusJSON(http.StatusOK, Message{
 			Status:  code,
 			Message: errors.Texts[code],
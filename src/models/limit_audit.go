@@ -0,0 +1,29 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// 限制管理操作
+const (
+	LimitAuditList    = "list"    // 列出限制
+	LimitAuditInspect = "inspect" // 查看限制
+	LimitAuditRemove  = "remove"  // 解除限制
+)
+
+// 限制管理操作记录，用于审计管理员查看及解除限制的操作
+type LimitAudit struct {
+	ID        int
+	Operator  string `gorm:"index"` // 操作人
+	Action    string `gorm:"index"`
+	LimitKey  string `gorm:"index"` // 操作的限制 key，列出限制时为查询前缀
+	Detail    string // 操作详情，解除限制时为解除前的限制
+	IP        string
+	CreatedAt time.Time `gorm:"index"`
+}
+
+// 添加限制管理操作记录
+func (m *Model) AddLimitAudit(ctx context.Context, audit *LimitAudit) error {
+	return m.DB.WithContext(ctx).Create(audit).Error
+}
@@ -12,4 +12,5 @@ type Model struct {
 	GAC               *google_authenticator.Client
 	UserValidator     validators.User
 	RecommendersCache *cache.Recommenders
+	ChainsCache       *cache.RecommenderChains
 }
@@ -0,0 +1,106 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// 每次生成的恢复码数量
+const RecoveryCodeCount = 10
+
+// 恢复码字符，不包含易混淆的 0、1、i、l、o
+var recoveryCodeSource = []byte("23456789abcdefghjkmnpqrstuvwxyz")
+
+// 谷歌验证器恢复码，用户丢失验证器时可代替谷歌验证码使用一次，使用后删除，仅保存恢复码的哈希值
+type RecoveryCode struct {
+	ID        int
+	UserID    int    `gorm:"index"`
+	Hash      string `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// 为用户生成一组新的恢复码，原有恢复码全部失效，明文仅在生成时返回一次
+func (m *Model) GenerateRecoveryCodes(userID int) (codes []string, err error) {
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		codes, err = generateRecoveryCodes(tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// 在事务 tx 中替换用户的恢复码
+func generateRecoveryCodes(tx *gorm.DB, userID int) ([]string, error) {
+	codes := make([]string, RecoveryCodeCount)
+	records := make([]*RecoveryCode, RecoveryCodeCount)
+	for i := range codes {
+		code, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code
+		records[i] = &RecoveryCode{UserID: userID, Hash: hashRecoveryCode(code)}
+	}
+	err := tx.Where("user_id=?", userID).Delete(&RecoveryCode{}).Error
+	if err != nil {
+		return nil, err
+	}
+	err = tx.Create(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// 获得用户剩余的恢复码数量
+func (m *Model) CountRecoveryCodes(userID int) (int64, error) {
+	var count int64
+	err := m.DB.Model(&RecoveryCode{}).Where("user_id=?", userID).Count(&count).Error
+	return count, err
+}
+
+// 使用恢复码，恢复码有效则删除并返回 true，并发使用同一恢复码时只有一个请求成功
+func (m *Model) UseRecoveryCode(userID int, code string) (bool, error) {
+	db := m.DB.Where("user_id=? AND hash=?", userID, hashRecoveryCode(code)).Delete(&RecoveryCode{})
+	if db.Error != nil {
+		return false, db.Error
+	}
+	return db.RowsAffected > 0, nil
+}
+
+// 生成 xxxxx-xxxxx 格式的恢复码，需使用密码学安全的随机数
+func newRecoveryCode() (string, error) {
+	// 丢弃超出字符数整数倍的随机数，使每个字符出现的概率相同
+	limit := 256 - 256%len(recoveryCodeSource)
+	code := make([]byte, 0, 11)
+	random := make([]byte, 16)
+	for len(code) < 11 {
+		_, err := rand.Read(random)
+		if err != nil {
+			return "", err
+		}
+		for _, b := range random {
+			if len(code) == 5 {
+				code = append(code, '-')
+			}
+			if int(b) < limit && len(code) < 11 {
+				code = append(code, recoveryCodeSource[int(b)%len(recoveryCodeSource)])
+			}
+		}
+	}
+	return string(code), nil
+}
+
+// 恢复码随机生成且足够长，无需使用 bcrypt 等慢哈希，忽略大小写、空格及分隔符
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.NewReplacer("-", "", " ", "").Replace(code)
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
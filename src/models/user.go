@@ -1,7 +1,10 @@
 package models
 
 import (
+	"context"
 	"fmt"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/google_authenticator"
 	"github.com/morgine/moon/pkg/rand"
 	"github.com/morgine/moon/src/errors"
 	"golang.org/x/crypto/bcrypt"
@@ -121,8 +124,21 @@ func (m *Model) GetGoogleAuthenticatorQRCodeUrl(loginUserID, with, height int) (
 	}
 }
 
-// 检测谷歌验证码
-func (m *Model) VerifyGoogleAuthCode(username, googleAuthCode string) error {
+// 获得谷歌验证器二维码图片，图片在本地生成，size 为图片边长(像素)
+func (m *Model) GetGoogleAuthenticatorQRCode(loginUserID int, format google_authenticator.ImageFormat, size int) ([]byte, error) {
+	user, err := m.GetUserByID(loginUserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("用户[id=%d]不存在", loginUserID)
+	} else {
+		return m.GAC.QRCode(user.GoogleAuthSecret, user.Username, format, size)
+	}
+}
+
+// 检测谷歌验证码，已绑定谷歌验证器的用户也可使用恢复码代替，恢复码使用后失效
+func (m *Model) VerifyGoogleAuthCode(ctx context.Context, username, googleAuthCode string) error {
 	user, err := m.GetUserByUsername(username)
 	if err != nil {
 		return err
@@ -130,7 +146,18 @@ func (m *Model) VerifyGoogleAuthCode(username, googleAuthCode string) error {
 	if user == nil {
 		return fmt.Errorf("用户名 %s 不存在", username)
 	}
-	ok, err := m.GAC.Verify(user.GoogleAuthSecret, googleAuthCode)
+	return m.verifyGoogleAuthCode(ctx, user, googleAuthCode, user.IsBindGoogleAuth)
+}
+
+func (m *Model) verifyGoogleAuthCode(ctx context.Context, user *User, googleAuthCode string, allowRecoveryCode bool) error {
+	ok, err := m.GAC.VerifyContext(ctx, user.GoogleAuthSecret, googleAuthCode)
+	if err == google_authenticator.ErrInvalidCode {
+		if !allowRecoveryCode {
+			return errors.GoogleAuthCodeIncorrect
+		}
+		// 不是验证码格式，作为恢复码使用
+		ok, err = m.UseRecoveryCode(user.ID, googleAuthCode)
+	}
 	if err != nil {
 		return err
 	}
@@ -141,22 +168,62 @@ func (m *Model) VerifyGoogleAuthCode(username, googleAuthCode string) error {
 	}
 }
 
-// 绑定谷歌验证器，绑定后不可修改
-func (m *Model) BindGoogleAuth(userID int, googleAuthCode string) error {
+// 绑定谷歌验证器，绑定后不可修改，绑定时只接受谷歌验证码，成功后返回新生成的恢复码。
+// 绑定状态及恢复码在同一事务中写入，已绑定的用户返回 GoogleAuthAlreadyBound
+func (m *Model) BindGoogleAuth(ctx context.Context, userID int, googleAuthCode string) (codes []string, err error) {
 	user, err := m.GetUserByID(userID)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("用户[id=%d]不存在", userID)
+	}
+	if user.IsBindGoogleAuth {
+		return nil, errors.GoogleAuthAlreadyBound
 	}
-	err = m.VerifyGoogleAuthCode(user.Username, googleAuthCode)
+	err = m.verifyGoogleAuthCode(ctx, user, googleAuthCode, false)
 	if err != nil {
+		return nil, err
+	}
+	err = m.DB.Transaction(func(tx *gorm.DB) error {
+		// 仅更新未绑定的用户，并发绑定时只有一个请求生成恢复码
+		db := tx.Model(&User{}).Where("id=? AND is_bind_google_auth=?", userID, false).UpdateColumn("is_bind_google_auth", true)
+		if db.Error != nil {
+			return db.Error
+		}
+		if db.RowsAffected == 0 {
+			return errors.GoogleAuthAlreadyBound
+		}
+		codes, err = generateRecoveryCodes(tx, userID)
 		return err
-	} else {
-		return m.DB.Model(&User{}).Where("id=?", userID).UpdateColumn("is_bind_google_auth", true).Error
+	})
+	if err != nil {
+		return nil, err
 	}
+	return codes, nil
+}
+
+// 重新生成恢复码，需要谷歌验证码或恢复码，原有恢复码全部失效
+func (m *Model) RegenerateRecoveryCodes(ctx context.Context, userID int, googleAuthCode string) ([]string, error) {
+	user, err := m.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("用户[id=%d]不存在", userID)
+	}
+	if !user.IsBindGoogleAuth {
+		return nil, errors.GoogleAuthNotBound
+	}
+	err = m.verifyGoogleAuthCode(ctx, user, googleAuthCode, true)
+	if err != nil {
+		return nil, err
+	}
+	return m.GenerateRecoveryCodes(userID)
 }
 
 // 重置密码
-func (m *Model) ResetPassword(userID int, googleAuthCode, newPassword string) error {
+func (m *Model) ResetPassword(ctx context.Context, userID int, googleAuthCode, newPassword string) error {
 	err := m.UserValidator.ValidPassword(newPassword)
 	if err != nil {
 		return err
@@ -165,7 +232,7 @@ func (m *Model) ResetPassword(userID int, googleAuthCode, newPassword string) er
 	if err != nil {
 		return err
 	}
-	err = m.VerifyGoogleAuthCode(user.Username, googleAuthCode)
+	err = m.VerifyGoogleAuthCode(ctx, user.Username, googleAuthCode)
 	if err != nil {
 		return err
 	}
@@ -176,28 +243,75 @@ func (m *Model) ResetPassword(userID int, googleAuthCode, newPassword string) er
 	return m.DB.Where("id=?", userID).Updates(&User{Password: string(password)}).Error
 }
 
-// 获得推荐人(自带缓存)
-func (m *Model) GetRecommender(userID int) (recommenderID int, err error) {
-	recommenderID, err = m.RecommendersCache.Get(userID)
+// 获得推荐人(自带缓存)，用户不存在则返回 gorm.ErrRecordNotFound
+func (m *Model) GetRecommender(ctx context.Context, userID int) (recommenderID int, err error) {
+	recommenderID, ok, err := m.RecommendersCache.GetOrLoad(ctx, userID, func(ctx context.Context) (int, bool, error) {
+		user := &User{}
+		err := m.DB.WithContext(ctx).Where("id=?", userID).Select("recommender").First(user).Error
+		if err == gorm.ErrRecordNotFound {
+			return 0, false, nil
+		} else if err != nil {
+			return 0, false, err
+		} else {
+			return user.Recommender, true, nil
+		}
+	})
 	if err != nil {
 		return 0, err
 	}
-	if recommenderID < 0 {
-		user := &User{}
-		err = m.DB.Where("id=?", userID).Select("recommender").First(user).Error
+	if !ok {
+		return 0, gorm.ErrRecordNotFound
+	}
+	return recommenderID, nil
+}
+
+// 推荐关系最大层级，用于检测推荐关系是否存在循环
+const MaxRecommenderDepth = 100
+
+// 获得最多 depth 级推荐人(自带缓存)，chain[0] 为直接推荐人，推荐人不存在时返回已获得的部分
+func (m *Model) GetRecommenderChain(ctx context.Context, userID, depth int) (chain []int, err error) {
+	chain, err = m.ChainsCache.GetOrLoad(ctx, userID, depth, func(ctx context.Context, userID int) (int, bool, error) {
+		recommenderID, err := m.GetRecommender(ctx, userID)
+		if err == gorm.ErrRecordNotFound {
+			return 0, false, nil
+		}
+		return recommenderID, err == nil, err
+	})
+	if err == cache.ErrRecommenderCycle {
+		return nil, errors.RecommenderCycle
+	}
+	return chain, err
+}
+
+// 修改推荐人，新的推荐关系不能形成循环，推荐人不存在则返回 gorm.ErrRecordNotFound
+func (m *Model) SetRecommender(ctx context.Context, userID, recommenderID int) error {
+	if recommenderID == userID {
+		return errors.RecommenderCycle
+	}
+	if recommenderID > 0 {
+		_, err := m.GetRecommender(ctx, recommenderID)
 		if err != nil {
-			return 0, err
-		} else {
-			err = m.RecommendersCache.Set(userID, user.Recommender)
-			if err != nil {
-				return 0, err
-			} else {
-				return user.Recommender, nil
+			return err
+		}
+		chain, err := m.GetRecommenderChain(ctx, recommenderID, MaxRecommenderDepth)
+		if err != nil {
+			return err
+		}
+		for _, id := range chain {
+			if id == userID {
+				return errors.RecommenderCycle
 			}
 		}
-	} else {
-		return recommenderID, nil
 	}
+	err := m.DB.WithContext(ctx).Model(&User{}).Where("id=?", userID).UpdateColumn("recommender", recommenderID).Error
+	if err != nil {
+		return err
+	}
+	err = m.RecommendersCache.Delete(ctx, userID)
+	if err != nil {
+		return err
+	}
+	return m.ChainsCache.Invalidate(ctx, userID)
 }
 
 // 设置用户头像
@@ -2,8 +2,38 @@ package routes
 
 import (
 	"github.com/gin-gonic/gin"
+	"github.com/morgine/moon/src/handlers"
 )
 
 type Router struct {
 	rg *gin.RouterGroup
 }
+
+func NewRouter(rg *gin.RouterGroup) *Router {
+	return &Router{rg: rg}
+}
+
+// 注册用户路由，注册及登陆需要经过 usr.RateLimit 限速，其他路由需要经过 usr.Auth 鉴权
+func (r *Router) User(usr *handlers.User) {
+	public := r.rg.Group("", usr.RateLimit())
+	public.POST("/register", usr.Register())
+	public.POST("/login", usr.Login())
+	auth := r.rg.Group("", usr.Auth)
+	auth.GET("/info", usr.GetInfo)
+	auth.GET("/recommender", usr.GetRecommender)
+	auth.GET("/google_authenticator/qrcode_url", usr.GetGoogleAuthenticatorQRCodeUrl())
+	auth.GET("/google_authenticator/qrcode", usr.GoogleAuthenticatorQRCode())
+	auth.POST("/google_authenticator/bind", usr.BindGoogle())
+	auth.GET("/recovery_codes/count", usr.GetRecoveryCodesCount)
+	auth.POST("/recovery_codes", usr.RegenerateRecoveryCodes())
+	auth.POST("/reset_password", usr.ResetPassword())
+	auth.POST("/avatar", usr.SaveAvatar())
+	auth.POST("/logout", usr.Logout)
+}
+
+// 注册限制管理路由，管理员鉴权由 LimitAdminOptions.Operator 完成
+func (r *Router) LimitAdmin(la *handlers.LimitAdmin) {
+	r.rg.GET("/limits", la.ListLimits())
+	r.rg.GET("/limits/detail", la.GetLimit())
+	r.rg.POST("/limits/remove", la.RemoveLimit())
+}
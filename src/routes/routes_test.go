@@ -0,0 +1,255 @@
+package routes_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/morgine/moon/pkg/cache"
+	"github.com/morgine/moon/pkg/limiter"
+	"github.com/morgine/moon/pkg/redis_session"
+	"github.com/morgine/moon/pkg/x_time"
+	"github.com/morgine/moon/src/errors"
+	"github.com/morgine/moon/src/handlers"
+	"github.com/morgine/moon/src/models"
+	"github.com/morgine/moon/src/routes"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 使用测试数据库、miniredis 缓存及会话创建路由，opts 的其他配置由调用方设置
+func newEngine(t *testing.T, client *redis.Client, opts *handlers.Options) *gin.Engine {
+	opts.DB = newDB(t)
+	opts.CacheClient = cache.NewRedisClient(client, time.Second)
+	opts.Session = redis_session.NewStorage("session_", client)
+	opts.AuthExpires = 3600
+	opts.AesCryptKey = []byte("0123456789abcdef")
+	usr, err := handlers.NewUser(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	routes.NewRouter(engine.Group("/user")).User(usr)
+	return engine
+}
+
+// 在测试临时目录中创建 sqlite 数据库
+func newDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "moon.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// 启动 miniredis 并返回客户端，返回的函数用于关闭
+func newRedis(t *testing.T) (*redis.Client, func()) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	return client, func() {
+		_ = client.Close()
+		mr.Close()
+	}
+}
+
+// 注册账号，失败则终止测试
+func register(t *testing.T, engine *gin.Engine, body string) {
+	if msg := serve(t, engine, context.Background(), "POST", "/user/register", "", body); msg.Status != errors.StatusOK {
+		t.Fatalf("register need: %d, got: %d %s\n", errors.StatusOK, msg.Status, msg.Message)
+	}
+}
+
+// 发送请求并解析响应，ctx 为请求的 context
+func serve(t *testing.T, engine *gin.Engine, ctx context.Context, method, path, token, body string) *handlers.Message {
+	req := newRequest(method, path, body).WithContext(ctx)
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	return serveRequest(t, engine, req)
+}
+
+// 创建 JSON 请求
+func newRequest(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return req
+}
+
+// 发送请求并解析响应
+func serveRequest(t *testing.T, engine *gin.Engine, req *http.Request) *handlers.Message {
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s %s need: 200, got: %d\n", req.Method, req.URL, w.Code)
+	}
+	msg := &handlers.Message{}
+	err := json.Unmarshal(w.Body.Bytes(), msg)
+	if err != nil {
+		t.Fatalf("%s %s: %v, body: %s\n", req.Method, req.URL, err, w.Body.String())
+	}
+	return msg
+}
+
+func TestRouter_Recommender(t *testing.T) {
+	ctx := context.Background()
+	client, closeRedis := newRedis(t)
+	defer closeRedis()
+	engine := newEngine(t, client, &handlers.Options{})
+	register(t, engine, `{"Username": "recommender", "Password": "password01"}`)
+	register(t, engine, `{"Username": "username01", "Password": "password01", "RecommenderID": 1}`)
+	msg := serve(t, engine, ctx, "POST", "/user/login", "", `{"Username": "username01", "Password": "password01"}`)
+	token, _ := msg.Data.(string)
+	if msg.Status != errors.StatusOK || token == "" {
+		t.Fatalf("login need: token, got: %d %s\n", msg.Status, msg.Message)
+	}
+	// 推荐人通过请求的 context 从数据库加载并写入缓存
+	msg = serve(t, engine, ctx, "GET", "/user/recommender", token, "")
+	if msg.Status != errors.StatusOK || msg.Data != float64(1) {
+		t.Errorf("recommender need: 1, got: %d %v %s\n", msg.Status, msg.Data, msg.Message)
+	}
+	// 请求取消后缓存操作随之取消
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	msg = serve(t, engine, canceled, "GET", "/user/recommender", token, "")
+	if msg.Status == errors.StatusOK || !strings.Contains(msg.Message, context.Canceled.Error()) {
+		t.Errorf("canceled recommender need: %v, got: %d %v %s\n", context.Canceled, msg.Status, msg.Data, msg.Message)
+	}
+}
+
+func TestRouter_LoginLimit(t *testing.T) {
+	ctx := context.Background()
+	client, closeRedis := newRedis(t)
+	defer closeRedis()
+	// 第 3 次失败起锁定 1 分钟
+	loginLimiter := limiter.NewMemoryLimiter(limiter.NewTimesLimiter(limiter.Linear(2, time.Minute, time.Hour)))
+	engine := newEngine(t, client, &handlers.Options{LoginLimiter: loginLimiter})
+	for i := 1; i <= 3; i++ {
+		register(t, engine, fmt.Sprintf(`{"Username": "username0%d", "Password": "password01"}`, i))
+	}
+	// 同一 IP 多次登陆成功不会被锁定
+	for i := 0; i < 5; i++ {
+		for j := 1; j <= 3; j++ {
+			msg := serve(t, engine, ctx, "POST", "/user/login", "", fmt.Sprintf(`{"Username": "username0%d", "Password": "password01"}`, j))
+			if msg.Status != errors.StatusOK {
+				t.Fatalf("login %d need: %d, got: %d %s\n", i, errors.StatusOK, msg.Status, msg.Message)
+			}
+		}
+	}
+	// 不同用户名的密码错误累计到 IP
+	for i, need := range []errors.Code{
+		errors.UsernameOrPasswordIncorrect,
+		errors.UsernameOrPasswordIncorrect,
+		errors.UsernameOrPasswordIncorrect,
+		errors.IPTemporarilyLocked,
+	} {
+		msg := serve(t, engine, ctx, "POST", "/user/login", "", fmt.Sprintf(`{"Username": "username0%d", "Password": "incorrect"}`, i%3+1))
+		if msg.Status != need {
+			t.Errorf("failed login %d need: %d, got: %d %s\n", i, need, msg.Status, msg.Message)
+		}
+	}
+}
+
+func TestRouter_LimitAdmin(t *testing.T) {
+	db := newDB(t)
+	loginLimiter := limiter.NewMemoryLimiter(limiter.NewTimesLimiter(limiter.Linear(0, time.Minute, time.Hour)))
+	la, err := handlers.NewLimitAdmin(&handlers.LimitAdminOptions{
+		DB:      db,
+		Limiter: loginLimiter,
+		Operator: func(ctx *gin.Context) (operator string, ok bool) {
+			operator = ctx.GetHeader("X-Operator")
+			return operator, operator != ""
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gin.SetMode(gin.TestMode)
+	engine := gin.New()
+	routes.NewRouter(engine.Group("/admin")).LimitAdmin(la)
+	_, _, _ = loginLimiter.AddOneTimes(context.Background(), "login_ip:1.2.3.4")
+	// 直连地址不是可信代理，伪造的 X-Forwarded-For 不会写入操作记录
+	request := func(method, path, body string) *handlers.Message {
+		req := newRequest(method, path, body)
+		req.Header.Set("X-Operator", "admin")
+		req.Header.Set("X-Forwarded-For", "9.9.9.9")
+		return serveRequest(t, engine, req)
+	}
+	if msg := serveRequest(t, engine, newRequest("GET", "/admin/limits", "")); msg.Status != errors.UserUnauthorized {
+		t.Errorf("unauthorized need: %d, got: %d\n", errors.UserUnauthorized, msg.Status)
+	}
+	msg := request("GET", "/admin/limits?Prefix=login_ip:", "")
+	if data, _ := msg.Data.(map[string]interface{}); msg.Status != errors.StatusOK || data["Total"] != float64(1) {
+		t.Errorf("list need: 1 limit, got: %d %v\n", msg.Status, msg.Data)
+	}
+	if msg = request("GET", "/admin/limits/detail?Key=login_ip:1.2.3.4", ""); msg.Status != errors.StatusOK {
+		t.Errorf("get need: %d, got: %d %s\n", errors.StatusOK, msg.Status, msg.Message)
+	}
+	if msg = request("GET", "/admin/limits/detail?Key=login_ip:5.6.7.8", ""); msg.Status != errors.StatusNotFound {
+		t.Errorf("get missing need: %d, got: %d\n", errors.StatusNotFound, msg.Status)
+	}
+	if msg = request("POST", "/admin/limits/remove", `{"Key": "login_ip:1.2.3.4"}`); msg.Status != errors.StatusOK {
+		t.Errorf("remove need: %d, got: %d %s\n", errors.StatusOK, msg.Status, msg.Message)
+	}
+	if limitIn, _, _ := loginLimiter.CheckLimit(context.Background(), "login_ip:1.2.3.4"); limitIn != 0 {
+		t.Errorf("limitIn need: 0 after remove, got: %v\n", limitIn)
+	}
+	// 每次操作均有记录，未通过鉴权的请求不记录
+	var audits []models.LimitAudit
+	if err = db.Order("id").Find(&audits).Error; err != nil {
+		t.Fatal(err)
+	}
+	actions := []string{models.LimitAuditList, models.LimitAuditInspect, models.LimitAuditInspect, models.LimitAuditRemove}
+	if len(audits) != len(actions) {
+		t.Fatalf("audits need: %d, got: %d\n", len(actions), len(audits))
+	}
+	for i, audit := range audits {
+		if audit.Action != actions[i] || audit.Operator != "admin" || audit.IP != "192.0.2.1" {
+			t.Errorf("audit %d need: %s by admin from 192.0.2.1, got: %+v\n", i, actions[i], audit)
+		}
+	}
+	if last := audits[len(audits)-1]; last.LimitKey != "login_ip:1.2.3.4" || !strings.Contains(last.Detail, `"Times":1`) {
+		t.Errorf("remove audit need: limit before remove, got: %+v\n", last)
+	}
+}
+
+func TestRouter_RateLimit(t *testing.T) {
+	ctx := context.Background()
+	client, closeRedis := newRedis(t)
+	defer closeRedis()
+	clock := x_time.NewFake(time.Now())
+	engine := newEngine(t, client, &handlers.Options{
+		RateLimiter: limiter.NewTokenBucket(limiter.TokenBucketConfig{Rate: 2, Period: time.Minute, Clock: clock}),
+	})
+	register(t, engine, `{"Username": "username01", "Password": "password01"}`)
+	msg := serve(t, engine, ctx, "POST", "/user/login", "", `{"Username": "username01", "Password": "password01"}`)
+	token, _ := msg.Data.(string)
+	if msg.Status != errors.StatusOK || token == "" {
+		t.Fatalf("login need: token, got: %d %s\n", msg.Status, msg.Message)
+	}
+	// 配额用尽后注册及登陆返回 429
+	w := httptest.NewRecorder()
+	engine.ServeHTTP(w, newRequest("POST", "/user/login", `{"Username": "username01", "Password": "password01"}`))
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "30" {
+		t.Errorf("limited login need: 429 retry after 30, got: %d %q\n", w.Code, w.Header().Get("Retry-After"))
+	}
+	// 鉴权后的路由不受限制
+	if msg = serve(t, engine, ctx, "GET", "/user/info", token, ""); msg.Status != errors.StatusOK {
+		t.Errorf("info need: %d, got: %d %s\n", errors.StatusOK, msg.Status, msg.Message)
+	}
+	clock.Advance(30 * time.Second)
+	if msg = serve(t, engine, ctx, "POST", "/user/login", "", `{"Username": "username01", "Password": "password01"}`); msg.Status != errors.StatusOK {
+		t.Errorf("login after refill need: %d, got: %d %s\n", errors.StatusOK, msg.Status, msg.Message)
+	}
+}